@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.i3wm.org/i3/v4"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AUTOSAVE_DELAY = 2 * time.Second // since the last event
+	AUTOSAVE_RETRY = 5 * time.Second // after losing i3
+)
+
+// Changes of window events that affect layouts
+var autosaveWindowChanges = map[string]bool{
+	"new":             true,
+	"close":           true,
+	"move":            true,
+	"floating":        true,
+	"fullscreen_mode": true,
+	"mark":            true,
+}
+
+// autosaveMu serializes saves, along with openGroupsSeen
+var autosaveMu sync.Mutex
+
+// autosaveTriggers tells whether event may change the layout of some group
+func autosaveTriggers(event i3.Event) bool {
+	switch e := event.(type) {
+	case *i3.WindowEvent:
+		return autosaveWindowChanges[e.Change]
+	case *i3.WorkspaceEvent:
+		return e.Change == "move" || e.Change == "rename"
+	case *i3.BindingEvent:
+		// i3 sends no event on resize
+		return strings.Contains(e.Binding.Command, "resize")
+	}
+	return false
+}
+
+// saveOpenGroups records the groups open and, if preferred, saves as
+// latest the layout of each of them, unless it didn't change
+func saveOpenGroups() {
+	autosaveMu.Lock()
+	defer autosaveMu.Unlock()
+	tree, err := i3.GetTree()
+	if err != nil {
+		log.Println("Error getting tree to save open groups", err)
+		return
+	}
+	groups := getOpenGroups(&tree)
+	recordOpenGroups(groups)
+	if !*pref.Autosave {
+		return
+	}
+	for _, g := range groups {
+		key := groupKey(g.Group, g.Host)
+		layout, err := getGroupLayout(&tree, g.Group, g.Host, pref.OtherWindows)
+		if err != nil {
+			log.Println("Error getting layout of", key, err)
+			continue
+		}
+		if len(layout.Workspaces) == 0 {
+			continue
+		}
+		j, err := json.Marshal(layout)
+		if err != nil {
+			log.Println("Error serializing layout of", key, err)
+			continue
+		}
+		p := layoutPath(g.Group, g.Host)
+		if saved, err := ioutil.ReadFile(p); err == nil && bytes.Equal(saved, j) {
+			continue
+		}
+		if err := ioutil.WriteFile(p, j, 0644); err != nil {
+			log.Println("Error autosaving layout of", key, err)
+			continue
+		}
+		log.Println("Autosaved layout of", key)
+	}
+}
+
+// watchI3Events saves the groups open, and their layouts, once i3 events
+// settle. It resubscribes whenever i3 goes away, e.g. on restart.
+func watchI3Events() {
+	timer := time.AfterFunc(AUTOSAVE_DELAY, saveOpenGroups)
+	timer.Stop()
+	for {
+		recv := i3.Subscribe(i3.WindowEventType, i3.WorkspaceEventType,
+			i3.BindingEventType, i3.ShutdownEventType)
+		for recv.Next() {
+			event := recv.Event()
+			if _, ok := event.(*i3.ShutdownEvent); ok {
+				// Windows closing from now on are not closed by the user
+				break
+			}
+			if e, ok := event.(*i3.WindowEvent); ok && e.Change == "close" {
+				handleWindowClose(&e.Container)
+			}
+			if autosaveTriggers(event) {
+				timer.Reset(AUTOSAVE_DELAY)
+			}
+		}
+		timer.Stop()
+		log.Println("Stopped receiving i3 events:", recv.Close())
+		autosaveMu.Lock()
+		openGroupsSeen = false
+		autosaveMu.Unlock()
+		time.Sleep(AUTOSAVE_RETRY)
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/gob"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"os/exec"
@@ -21,27 +20,32 @@ func newClient() (*Client, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("Server not up, starting it ...")
-			cmd := exec.Command(I3TMUX_BIN, "-server")
+			cmd := exec.Command(I3TMUX_BIN, "server")
 			err := cmd.Start()
 			if err != nil {
-				return nil, fmt.Errorf("starting server: %w", err)
+				return nil, withExitCode(ExitServer, fmt.Errorf("starting server: %w", err))
 			}
 			time.Sleep(1 * time.Second) // FIXME: choose better way to check for server being up
 		} else {
-			return nil, fmt.Errorf("checking existing of server socket: %w", err)
+			return nil, withExitCode(ExitServer, fmt.Errorf("checking existing of server socket: %w", err))
 		}
 	}
 	_, err = os.Stat(SERVER_SOCK)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Fatalf("Server did not start: %s\n", err)
+			return nil, withExitCode(ExitServer, fmt.Errorf("server did not start: %w", err))
 		}
 	}
 	// Check if server socket exists
 
+	return dialServer()
+}
+
+// dialServer connects to an already running server
+func dialServer() (*Client, error) {
 	conn, err := net.Dial("unix", SERVER_SOCK)
 	if err != nil {
-		return nil, fmt.Errorf("dialling server: %+v", err)
+		return nil, withExitCode(ExitServer, fmt.Errorf("dialling server: %+v", err))
 	}
 	return &Client{
 		conn: conn,
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Command is an i3tmux subcommand with its own flags
+type Command struct {
+	Name    string
+	Args    string // synopsis of the positional arguments
+	Summary string
+	Hidden  bool // left out of help and completion
+	// Notifies tells whether errors are shown as desktop notifications,
+	// for commands run from i3 bindings without a terminal
+	Notifies bool
+	// NArgs is the number of positional arguments, -1 for any
+	NArgs int
+	Flags *flag.FlagSet
+	Run   func(args []string) error
+}
+
+func newCommand(name, args, summary string, nargs int) *Command {
+	c := &Command{
+		Name:    name,
+		Args:    args,
+		Summary: summary,
+		NArgs:   nargs,
+		Flags:   flag.NewFlagSet(name, flag.ContinueOnError),
+	}
+	c.Flags.Usage = func() { c.PrintUsage(c.Flags.Output()) }
+	return c
+}
+
+func (c *Command) PrintUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s %s [flags] %s\n\n%s.\n", I3TMUX, c.Name, c.Args, c.Summary)
+	hasFlags := false
+	c.Flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		c.Flags.SetOutput(w)
+		c.Flags.PrintDefaults()
+	}
+}
+
+// FlagNames returns the names of the flags of c, prefixed by a dash
+func (c *Command) FlagNames() []string {
+	var names []string
+	c.Flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+// takesValue tells whether arg is a flag of c followed by its value
+func (c *Command) takesValue(arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if name == arg || strings.Contains(name, "=") {
+		return false
+	}
+	f := c.Flags.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// Parse parses args, allowing flags to follow positional arguments
+// up to --, and checks the number of the latter
+func (c *Command) Parse(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.Flags.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			return nil, withExitCode(ExitUsage, err)
+		}
+		rest := c.Flags.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" &&
+			(n < 2 || !c.takesValue(args[n-2])) {
+			// Flag parsing ended with --
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if c.NArgs >= 0 && len(positional) != c.NArgs {
+		c.Flags.Usage()
+		return nil, usageErrorf("%s expects %d argument(s), %d given", c.Name, c.NArgs, len(positional))
+	}
+	return positional, nil
+}
+
+const (
+	hostUsage = "remote host where tmux server runs"
+)
+
+var (
+	terminalBinFlag  string
+	terminalNameFlag string
+	listFormat       string
+	listAllHostsFlag bool
+)
+
+// terminalFlags registers the flags overriding the terminal preferences
+func terminalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&terminalBinFlag, "terminal", "", "the binary path of the terminal to use")
+	fs.StringVar(&terminalNameFlag, "nameFlag", "", "the flag used by the terminal of choice "+
+		"to define the window instance name")
+}
+
+func requireTerminal() error {
+	if pref.Terminal.Bin == "" || pref.Terminal.NameFlag == "" {
+		return usageErrorf("you must specify 'terminal.bin' and 'terminal.nameFlag' options")
+	}
+	return nil
+}
+
+func requireHost(host string) error {
+	if host == "" {
+		return usageErrorf("you must specify the target host with -host")
+	}
+	return nil
+}
+
+// attachModeFlags registers the flags selecting the attach mode,
+// and returns a function returning the mode they select
+func attachModeFlags(fs *flag.FlagSet) func() (AttachMode, error) {
+	steal := fs.Bool("steal", false, "detach other clients, e.g., from other machines")
+	shared := fs.Bool("shared", false, "attach alongside other clients, marking the window title as shared")
+	readOnly := fs.Bool("read-only", false, "attach alongside other clients without sending input")
+	return func() (AttachMode, error) {
+		mode, count := AttachDefault, 0
+		if *steal {
+			mode, count = AttachSteal, count+1
+		}
+		if *shared {
+			mode, count = AttachShared, count+1
+		}
+		if *readOnly {
+			mode, count = AttachReadOnly, count+1
+		}
+		if count > 1 {
+			return mode, usageErrorf("-steal, -shared and -read-only are mutually exclusive")
+		}
+		return mode, nil
+	}
+}
+
+func createCommand() *Command {
+	c := newCommand("create", "GROUP", "Create a new group with a session", 1)
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts of GROUP in the group manifest")
+	cwd := c.Flags.String("cwd", "", "start directory of the session")
+	cmd := c.Flags.String("cmd", "", "initial command of the session")
+	c.Run = func(args []string) error {
+		return createAction(args[0], *host, *cwd, *cmd)
+	}
+	return c
+}
+
+func addCommand() *Command {
+	c := newCommand("add", "[GROUP]", "Add a session to GROUP, or to the group of the focused window", -1)
+	c.Notifies = true
+	host := c.Flags.String("host", "", hostUsage+", defaults to the first host of GROUP in the group manifest")
+	cwd := c.Flags.String("cwd", "", "start directory of the session, defaults to the focused one's")
+	cmd := c.Flags.String("cmd", "", "initial command of the session")
+	terminalFlags(c.Flags)
+	c.Run = func(args []string) error {
+		if len(args) > 1 {
+			return usageErrorf("add takes at most one group")
+		}
+		if err := requireTerminal(); err != nil {
+			return err
+		}
+		group := ""
+		if len(args) == 1 {
+			group = args[0]
+		}
+		return addAction(group, *host, *cwd, *cmd)
+	}
+	return c
+}
+
+func listCommand() *Command {
+	c := newCommand("list", "", "List sessions groups", 0)
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts in the group manifest")
+	c.Flags.BoolVar(&listAllHostsFlag, "all-hosts", false, "list groups of all hosts in ~/.ssh/config")
+	c.Flags.StringVar(&listFormat, "format", FORMAT_TABLE, "output format: table, plain or json")
+	c.Run = func(args []string) error {
+		switch listFormat {
+		case FORMAT_PLAIN, FORMAT_TABLE, FORMAT_JSON:
+		default:
+			return usageErrorf("unknown format %s", listFormat)
+		}
+		return listAction(*host)
+	}
+	return c
+}
+
+func resumeCommand() *Command {
+	c := newCommand("resume", "GROUP", "Resume a group with its saved layout", 1)
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts of GROUP in the group manifest")
+	layout := c.Flags.String("layout", "", "name or timestamp of the saved layout to resume, "+
+		"defaults to the latest")
+	here := c.Flags.Bool("here", false, "resume in the focused workspace rather than the saved ones")
+	mode := attachModeFlags(c.Flags)
+	terminalFlags(c.Flags)
+	c.Run = func(args []string) error {
+		if err := requireTerminal(); err != nil {
+			return err
+		}
+		m, err := mode()
+		if err != nil {
+			return err
+		}
+		return resumeAction(args[0], *host, ResumeOptions{Mode: m, Layout: *layout, Here: *here})
+	}
+	return c
+}
+
+func pickCommand() *Command {
+	c := newCommand("pick", "", "Pick a group to resume, or create, through a menu", 0)
+	c.Notifies = true
+	terminalFlags(c.Flags)
+	c.Run = func(args []string) error {
+		if err := requireTerminal(); err != nil {
+			return err
+		}
+		return pickAction()
+	}
+	return c
+}
+
+func detachCommand() *Command {
+	c := newCommand("detach", "", "Detach the group of the focused window saving its layout", 0)
+	c.Notifies = true
+	c.Run = func(args []string) error {
+		return detachAction()
+	}
+	return c
+}
+
+func switchCommand() *Command {
+	c := newCommand("switch", "[GROUP]", "Swap the group of the focused workspace for another", -1)
+	c.Notifies = true
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts of GROUP in the group manifest")
+	pick := c.Flags.Bool("pick", false, "pick GROUP through a menu")
+	terminalFlags(c.Flags)
+	c.Run = func(args []string) error {
+		if len(args) > 1 {
+			return usageErrorf("switch takes at most one group")
+		}
+		if err := requireTerminal(); err != nil {
+			return err
+		}
+		group := ""
+		if len(args) == 1 {
+			group = args[0]
+		}
+		if *pick {
+			return switchPickAction()
+		}
+		return switchAction(group, *host)
+	}
+	return c
+}
+
+func hideCommand() *Command {
+	c := newCommand("hide", "", "Hide the group of the focused window keeping its shells", 0)
+	c.Notifies = true
+	c.Run = func(args []string) error {
+		return hideAction()
+	}
+	return c
+}
+
+func showCommand() *Command {
+	c := newCommand("show", "GROUP", "Show a hidden group back where it was", 1)
+	c.Notifies = true
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts of GROUP in the group manifest")
+	c.Run = func(args []string) error {
+		return showAction(args[0], *host)
+	}
+	return c
+}
+
+func saveLayoutCommand() *Command {
+	c := newCommand("save-layout", "NAME", "Save the layout of the group of the focused window as NAME", 1)
+	c.Notifies = true
+	c.Run = func(args []string) error {
+		return saveLayoutAction(args[0])
+	}
+	return c
+}
+
+func layoutsCommand() *Command {
+	c := newCommand("layouts", "GROUP", "List the layouts saved for a group", 1)
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts of GROUP in the group manifest")
+	c.Run = func(args []string) error {
+		return layoutsAction(args[0], *host)
+	}
+	return c
+}
+
+func exportLayoutCommand() *Command {
+	c := newCommand("export-layout", "GROUP", "Print a saved layout of a group without hosts and group", 1)
+	host := c.Flags.String("host", "", hostUsage+", defaults to the hosts of GROUP in the group manifest")
+	layout := c.Flags.String("layout", "", "name or timestamp of the saved layout to export, "+
+		"defaults to the latest")
+	c.Run = func(args []string) error {
+		return exportLayoutAction(args[0], *host, *layout)
+	}
+	return c
+}
+
+func importLayoutCommand() *Command {
+	c := newCommand("import-layout", "GROUP", "Save the layout read from stdin for a group", 1)
+	host := c.Flags.String("host", "", hostUsage+", defaults to the host of GROUP in the group manifest")
+	name := c.Flags.String("name", "", "save the layout under this name instead of as the latest")
+	c.Run = func(args []string) error {
+		return importLayoutAction(args[0], *host, *name)
+	}
+	return c
+}
+
+func killCommand() *Command {
+	c := newCommand("kill", "", "Kill the session of the focused window locally and remotely", 0)
+	c.Notifies = true
+	c.Run = func(args []string) error {
+		return killAction()
+	}
+	return c
+}
+
+func cloneCommand() *Command {
+	c := newCommand("clone", "GROUP", "Clone a group onto another host", 1)
+	host := c.Flags.String("host", "", hostUsage)
+	to := c.Flags.String("to", "", "host to clone the group onto")
+	c.Run = func(args []string) error {
+		if err := requireHost(*host); err != nil {
+			return err
+		}
+		if *to == "" {
+			return usageErrorf("you must specify the host to clone onto with -to")
+		}
+		return cloneAction(args[0], *host, *to)
+	}
+	return c
+}
+
+func shellCommand() *Command {
+	c := newCommand("shell", "SESSION", "Spawn a shell attached to a session", 1)
+	host := c.Flags.String("host", "", hostUsage)
+	mode := attachModeFlags(c.Flags)
+	c.Run = func(args []string) error {
+		if err := requireHost(*host); err != nil {
+			return err
+		}
+		m, err := mode()
+		if err != nil {
+			return err
+		}
+		return shellAction(args[0], *host, m)
+	}
+	return c
+}
+
+func serverCommand() *Command {
+	c := newCommand("server", "", "Run the i3tmux server", 0)
+	c.Run = func(args []string) error {
+		return serverAction()
+	}
+	return c
+}
+
+func restoreSessionCommand() *Command {
+	c := newCommand("restore-session", "", "Resume the groups open before i3 restarted or the last logout", 0)
+	c.Notifies = true
+	terminalFlags(c.Flags)
+	c.Run = func(args []string) error {
+		if err := requireTerminal(); err != nil {
+			return err
+		}
+		return restoreSessionAction()
+	}
+	return c
+}
+
+func completionCommand() *Command {
+	c := newCommand("completion", "SHELL", "Print the completion script for bash, zsh or fish", 1)
+	c.Run = func(args []string) error {
+		return completionAction(args[0])
+	}
+	return c
+}
+
+func completeCommand() *Command {
+	c := newCommand(COMPLETE_MODE, "WHAT [HOST] PREFIX", "Print completion candidates", -1)
+	c.Hidden = true
+	c.Run = completeAction
+	return c
+}
+
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		createCommand(),
+		addCommand(),
+		listCommand(),
+		resumeCommand(),
+		pickCommand(),
+		switchCommand(),
+		detachCommand(),
+		hideCommand(),
+		showCommand(),
+		saveLayoutCommand(),
+		layoutsCommand(),
+		exportLayoutCommand(),
+		importLayoutCommand(),
+		killCommand(),
+		cloneCommand(),
+		shellCommand(),
+		restoreSessionCommand(),
+		serverCommand(),
+		completionCommand(),
+		completeCommand(),
+	}
+}
+
+func findCommand(name string) *Command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s COMMAND [flags] [args]\n\nCommands:\n", I3TMUX)
+	for _, c := range commands {
+		if c.Hidden {
+			continue
+		}
+		fmt.Fprintf(w, "  %-14s %s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s help COMMAND' for the flags of a command.\n\nExit codes:\n", I3TMUX)
+	for _, e := range exitCodesDoc {
+		fmt.Fprintf(w, "  %d  %s\n", e.Code, e.Doc)
+	}
+}
+
+// runCommand runs the command named by the first argument
+func runCommand(args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return usageErrorf("no command given")
+	}
+	name, args := args[0], args[1:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) == 0 {
+			printUsage(os.Stdout)
+			return nil
+		}
+		c := findCommand(args[0])
+		if c == nil {
+			return usageErrorf("unknown command %s", args[0])
+		}
+		c.PrintUsage(os.Stdout)
+		return nil
+	}
+
+	c := findCommand(name)
+	if c == nil {
+		printUsage(os.Stderr)
+		return usageErrorf("unknown command %s", strings.TrimLeft(name, "-"))
+	}
+	if c.Hidden {
+		// Hidden commands take their arguments verbatim
+		return c.Run(args)
+	}
+	positional, err := c.Parse(args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	pref = getUserPreferences()
+	err = c.Run(positional)
+	if err != nil && c.Notifies {
+		notifyError(c.Name, err)
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCommandParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		host, cmd  string
+		steal      bool
+	}{
+		{"flags first", []string{"-host", "h", "g"}, []string{"g"}, "h", "", false},
+		{"flags last", []string{"g", "-host", "h", "-steal"}, []string{"g"}, "h", "", true},
+		{"flags between", []string{"g", "-steal", "s"}, []string{"g", "s"}, "", "", true},
+		{"dashes end flags", []string{"-host", "h", "--", "g", "-steal"}, []string{"g", "-steal"}, "h", "", false},
+		{"dashes after positional", []string{"g", "--", "s", "-host", "h"}, []string{"g", "s", "-host", "h"}, "", "", false},
+		{"dashes as value", []string{"-cmd", "--", "g"}, []string{"g"}, "", "--", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newCommand("test", "ARGS", "Test", -1)
+			host := c.Flags.String("host", "", "")
+			cmd := c.Flags.String("cmd", "", "")
+			steal := c.Flags.Bool("steal", false, "")
+			positional, err := c.Parse(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(positional, test.positional) {
+				t.Errorf("expected positional %q, received %q", test.positional, positional)
+			}
+			if *host != test.host || *cmd != test.cmd || *steal != test.steal {
+				t.Errorf("expected -host %q -cmd %q -steal %t, received %q %q %t",
+					test.host, test.cmd, test.steal, *host, *cmd, *steal)
+			}
+		})
+	}
+}
+
+func TestCommandParseNArgs(t *testing.T) {
+	c := newCommand("test", "GROUP", "Test", 1)
+	c.Flags.SetOutput(&bytes.Buffer{})
+	if _, err := c.Parse([]string{"a", "b"}); err == nil {
+		t.Error("expected error on extra argument")
+	}
+}
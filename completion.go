@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	COMPLETE_MODE = "complete"
+
+	COMPLETE_HOST    = "host"
+	COMPLETE_GROUP   = "group"
+	COMPLETE_SESSION = "session"
+)
+
+// Completion scripts take the names of the commands (1) and
+// the completion of the flags of each command (2)
+
+const bashCompletion = `_i3tmux() {
+	local cur prev cmd host i
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+	if ((COMP_CWORD == 1)); then
+		COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+		return
+	fi
+	cmd="${COMP_WORDS[1]}"
+	for ((i = 2; i < COMP_CWORD - 1; i++)); do
+		case "${COMP_WORDS[i]}" in
+		-host|--host) host="${COMP_WORDS[i+1]}" ;;
+		esac
+	done
+	case "$prev" in
+	-host|--host|-to|--to)
+		COMPREPLY=($(i3tmux complete host "$cur")); return ;;
+	-format|--format)
+		COMPREPLY=($(compgen -W "plain table json" -- "$cur")); return ;;
+	esac
+	if [[ "$cur" == -* ]]; then
+		case "$cmd" in
+%[2]s		esac
+		return
+	fi
+	case "$cmd" in
+	resume|switch|clone|show|layouts|export-layout|import-layout)
+		COMPREPLY=($(i3tmux complete group "$host" "$cur")) ;;
+	shell)
+		COMPREPLY=($(i3tmux complete session "$host" "$cur")) ;;
+	completion)
+		COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+	help)
+		COMPREPLY=($(compgen -W "%[1]s" -- "$cur")) ;;
+	esac
+}
+complete -F _i3tmux i3tmux
+`
+
+const zshCompletion = `#compdef i3tmux
+_i3tmux() {
+	local cmd host i cur=${words[CURRENT]}
+	if (( CURRENT == 2 )); then
+		compadd -- %[1]s
+		return
+	fi
+	cmd=${words[2]}
+	i=${words[(I)-host]}
+	(( i )) && host=${words[i+1]}
+	case ${words[CURRENT-1]} in
+	-host|-to)
+		compadd -- ${(f)"$(i3tmux complete host "$cur")"}; return ;;
+	-format)
+		compadd -- plain table json; return ;;
+	esac
+	if [[ $cur == -* ]]; then
+		case $cmd in
+%[2]s		esac
+		return
+	fi
+	case $cmd in
+	resume|switch|clone|show|layouts|export-layout|import-layout)
+		compadd -- ${(f)"$(i3tmux complete group "$host" "$cur")"} ;;
+	shell)
+		compadd -- ${(f)"$(i3tmux complete session "$host" "$cur")"} ;;
+	completion)
+		compadd -- bash zsh fish ;;
+	help)
+		compadd -- %[1]s ;;
+	esac
+}
+compdef _i3tmux i3tmux
+`
+
+const fishCompletion = `function __i3tmux_host
+	set -l tokens (commandline -opc)
+	set -l i (contains -i -- -host $tokens)
+	and echo $tokens[(math $i + 1)]
+end
+complete -c i3tmux -f
+complete -c i3tmux -n '__fish_seen_subcommand_from resume switch clone show layouts export-layout import-layout' -a '(i3tmux complete group (__i3tmux_host) (commandline -ct))'
+complete -c i3tmux -n '__fish_seen_subcommand_from shell' -a '(i3tmux complete session (__i3tmux_host) (commandline -ct))'
+complete -c i3tmux -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c i3tmux -n '__fish_seen_subcommand_from help' -a '%[1]s'
+%[2]s`
+
+// visibleCommands returns the commands offered by completion
+func visibleCommands() []*Command {
+	var visible []*Command
+	for _, c := range commands {
+		if !c.Hidden {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+func completionAction(shell string) error {
+	var names []string
+	for _, c := range visibleCommands() {
+		names = append(names, c.Name)
+	}
+	names = append(names, "help")
+	var flags strings.Builder
+	switch shell {
+	case "bash":
+		for _, c := range visibleCommands() {
+			fmt.Fprintf(&flags, "\t\t%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n",
+				c.Name, strings.Join(c.FlagNames(), " "))
+		}
+		fmt.Printf(bashCompletion, strings.Join(names, " "), flags.String())
+	case "zsh":
+		for _, c := range visibleCommands() {
+			fmt.Fprintf(&flags, "\t\t%s) compadd -- %s ;;\n", c.Name, strings.Join(c.FlagNames(), " "))
+		}
+		fmt.Printf(zshCompletion, strings.Join(names, " "), flags.String())
+	case "fish":
+		for _, c := range visibleCommands() {
+			fmt.Fprintf(&flags, "complete -c i3tmux -n __fish_use_subcommand -a %s -d %q\n", c.Name, c.Summary)
+			c.Flags.VisitAll(func(f *flag.Flag) {
+				fmt.Fprintf(&flags, "complete -c i3tmux -n '__fish_seen_subcommand_from %s' -o %s -d %q",
+					c.Name, f.Name, f.Usage)
+				switch f.Name {
+				case "host", "to":
+					flags.WriteString(" -x -a '(i3tmux complete host (commandline -ct))'")
+				case "format":
+					flags.WriteString(" -x -a 'plain table json'")
+				}
+				flags.WriteString("\n")
+			})
+		}
+		fmt.Printf(fishCompletion, strings.Join(names, " "), flags.String())
+	default:
+		return usageErrorf("unsupported shell %s", shell)
+	}
+	return nil
+}
+
+// cachedSessionsOfHost asks the running server for the sessions it last
+// saw on host. It never starts the server nor reaches the host, to keep
+// completion fast.
+func cachedSessionsOfHost(host string) SessionsPerGroup {
+	if _, err := os.Stat(SERVER_SOCK); err != nil {
+		return nil
+	}
+	client, err := dialServer()
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+	res, err := client.RequestResponse(&RequestCachedSessions{RequestBase{host}})
+	if err != nil {
+		return nil
+	}
+	return res.(*ResponseCachedSessions).Sessions
+}
+
+// completeAction prints the candidates for what starting with the last
+// argument, one per line:
+//
+//	complete host PREFIX
+//	complete group HOST PREFIX
+//	complete session HOST PREFIX
+func completeAction(args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("missing what to complete")
+	}
+	what, prefix := args[0], ""
+	if len(args) > 1 {
+		prefix = args[len(args)-1]
+	}
+	var candidates []string
+	switch what {
+	case COMPLETE_HOST:
+		hosts, err := getKnownHosts()
+		if err != nil {
+			return err
+		}
+		candidates = hosts
+	case COMPLETE_GROUP, COMPLETE_SESSION:
+		if len(args) < 3 {
+			return nil
+		}
+		sessionsPerGroup := cachedSessionsOfHost(args[1])
+		for g, sessions := range sessionsPerGroup {
+			if what == COMPLETE_GROUP {
+				candidates = append(candidates, g)
+				continue
+			}
+			for s := range sessions {
+				candidates = append(candidates, serializeGroupSess(g, s))
+			}
+		}
+		if what == COMPLETE_GROUP && args[1] == "" {
+			manifest, err := getGroupManifest()
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, manifest.Groups()...)
+		}
+	default:
+		return usageErrorf("cannot complete %s", what)
+	}
+	sort.Strings(candidates)
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			fmt.Println(c)
+		}
+	}
+	return nil
+}
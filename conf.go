@@ -8,6 +8,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kevinburke/ssh_config"
 	"gopkg.in/yaml.v2"
@@ -85,12 +86,96 @@ func getConfForHost(host string) (*Conf, error) {
 	return conf, nil
 }
 
+// getKnownHosts returns the hosts declared in ~/.ssh/config,
+// leaving out wildcard patterns
+func getKnownHosts() ([]string, error) {
+	sshConfFile, err := os.Open(SSH_CONF)
+	if err != nil {
+		return nil, err
+	}
+	defer sshConfFile.Close()
+	sshConf, err := ssh_config.Decode(sshConfFile)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, h := range sshConf.Hosts {
+		for _, p := range h.Patterns {
+			host := p.String()
+			if strings.ContainsAny(host, "*?") || seen[host] {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// getListedHosts returns the known hosts matching the 'hosts' preference,
+// or all of them if no preference is given
+func getListedHosts() ([]string, error) {
+	knownHosts, err := getKnownHosts()
+	if err != nil {
+		return nil, fmt.Errorf("reading hosts of ~/.ssh/config: %w", err)
+	}
+	if len(pref.Hosts) == 0 {
+		return knownHosts, nil
+	}
+	var hosts []string
+	for _, host := range knownHosts {
+		for _, pattern := range pref.Hosts {
+			if ok, _ := path.Match(pattern, host); ok {
+				hosts = append(hosts, host)
+				break
+			}
+		}
+	}
+	return hosts, nil
+}
+
+const (
+	HOST_TIMEOUT_DEFAULT = 5 * time.Second
+)
+
 // Pref struct holds user preferences
 type Pref struct {
 	Terminal struct {
 		Bin      string
 		NameFlag string `yaml:"nameFlag"`
 	}
+	// Hosts (or glob patterns of them) to query with 'list -all-hosts'
+	Hosts []string
+	// HostTimeout bounds the time waited for each host
+	HostTimeout time.Duration `yaml:"hostTimeout"`
+	// Menu is the command 'pick' pipes groups to, e.g. [rofi, -dmenu]
+	Menu []string
+	// Notify selects what hotkey commands show as desktop notifications:
+	// none, errors or all
+	Notify string
+	// NewSessions selects where resume places sessions missing from
+	// the saved layout: split, tab or none
+	NewSessions string `yaml:"newSessions"`
+	// OtherWindows records the windows other than sessions in saved layouts,
+	// along with the structure of their containers
+	OtherWindows bool `yaml:"otherWindows"`
+	// GroupWorkspaces gives each group a workspace named GROUP@HOST
+	GroupWorkspaces bool `yaml:"groupWorkspaces"`
+	// Workspaces names the workspaces of groups, by GROUP@HOST or GROUP
+	Workspaces map[string]string
+	// SwitchMode is how 'switch' puts away the current group: hide or detach
+	SwitchMode string `yaml:"switchMode"`
+	// HideTo is where 'hide' moves groups: the scratchpad or a workspace
+	HideTo string `yaml:"hideTo"`
+	// OnClose is what the server does with sessions whose window is
+	// closed through i3: keep, kill or ask
+	OnClose string `yaml:"onClose"`
+	// Autosave makes the server save the layouts of open groups as they
+	// change, defaults to true
+	Autosave *bool
+	// LayoutHistory is the number of past layouts kept for each group
+	LayoutHistory int `yaml:"layoutHistory"`
 }
 
 func getUserPreferences() Pref {
@@ -106,11 +191,56 @@ func getUserPreferences() Pref {
 	} else {
 		log.Println(fmt.Errorf("Couldn't open dotfile, using flags or default values: %w", err))
 	}
-	if *terminalBinFlag != "" {
-		pref.Terminal.Bin = *terminalBinFlag
+	if terminalBinFlag != "" {
+		pref.Terminal.Bin = terminalBinFlag
+	}
+	if terminalNameFlag != "" {
+		pref.Terminal.NameFlag = terminalNameFlag
 	}
-	if *terminalNameFlag != "" {
-		pref.Terminal.NameFlag = *terminalNameFlag
+	if pref.HostTimeout <= 0 {
+		pref.HostTimeout = HOST_TIMEOUT_DEFAULT
+	}
+	switch pref.SwitchMode {
+	case SWITCH_HIDE, SWITCH_DETACH:
+	default:
+		if pref.SwitchMode != "" {
+			log.Printf("Unknown switchMode option %s, using %s", pref.SwitchMode, SWITCH_HIDE)
+		}
+		pref.SwitchMode = SWITCH_HIDE
+	}
+	switch pref.OnClose {
+	case ONCLOSE_KEEP, ONCLOSE_KILL, ONCLOSE_ASK:
+	default:
+		if pref.OnClose != "" {
+			log.Printf("Unknown onClose option %s, using %s", pref.OnClose, ONCLOSE_KEEP)
+		}
+		pref.OnClose = ONCLOSE_KEEP
+	}
+	if pref.Autosave == nil {
+		autosave := true
+		pref.Autosave = &autosave
+	}
+	if pref.HideTo == "" {
+		pref.HideTo = HIDE_TO_SCRATCHPAD
+	}
+	if pref.LayoutHistory <= 0 {
+		pref.LayoutHistory = LAYOUT_HISTORY_DEFAULT
+	}
+	switch pref.NewSessions {
+	case PLACE_SPLIT, PLACE_TAB, PLACE_NONE:
+	default:
+		if pref.NewSessions != "" {
+			log.Printf("Unknown newSessions option %s, using %s", pref.NewSessions, PLACE_SPLIT)
+		}
+		pref.NewSessions = PLACE_SPLIT
+	}
+	switch pref.Notify {
+	case NOTIFY_NONE, NOTIFY_ERRORS, NOTIFY_ALL:
+	default:
+		if pref.Notify != "" {
+			log.Printf("Unknown notify option %s, using %s", pref.Notify, NOTIFY_ERRORS)
+		}
+		pref.Notify = NOTIFY_ERRORS
 	}
 	return pref
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes of i3tmux, one per class of error
+const (
+	ExitOk            = 0 // command succeeded
+	ExitFailure       = 1 // unclassified failure
+	ExitUsage         = 2 // invalid command, flags or arguments
+	ExitUnreachable   = 3 // host missing from ~/.ssh/config or not reachable
+	ExitNotFound      = 4 // group or session not found
+	ExitAlreadyExists = 5 // group already exists
+	ExitInvalidName   = 6 // invalid group name
+	ExitI3            = 7 // i3 not reachable or focused window not an i3tmux session
+	ExitServer        = 8 // i3tmux server not reachable
+)
+
+var exitCodesDoc = []struct {
+	Code int
+	Doc  string
+}{
+	{ExitOk, "command succeeded"},
+	{ExitFailure, "unclassified failure"},
+	{ExitUsage, "invalid command, flags or arguments"},
+	{ExitUnreachable, "host missing from ~/.ssh/config or not reachable"},
+	{ExitNotFound, "group or session not found"},
+	{ExitAlreadyExists, "group already exists"},
+	{ExitInvalidName, "invalid group name"},
+	{ExitI3, "i3 not reachable or focused window not an i3tmux session"},
+	{ExitServer, "i3tmux server not reachable"},
+}
+
+// exitError is an error carrying the exit code of its class
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code, err}
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return withExitCode(ExitUsage, fmt.Errorf(format, a...))
+}
+
+// exitCodeOf returns the exit code of the class of err
+func exitCodeOf(err error) int {
+	if err == nil {
+		return ExitOk
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return ExitFailure
+}
+
+// responseError turns the error of a response into one carrying its exit code
+func responseError(errCode int, errMsg string) error {
+	switch errCode {
+	case ErrOk:
+		return nil
+	case TmuxNoSessionsError:
+		return withExitCode(ExitNotFound, fmt.Errorf("no session found"))
+	case GroupNotFoundError:
+		return withExitCode(ExitNotFound, fmt.Errorf("group not found"))
+	case GroupAlreadyExistsError:
+		return withExitCode(ExitAlreadyExists, fmt.Errorf("group already exists"))
+	case InvalidGroupNameError:
+		return withExitCode(ExitInvalidName, fmt.Errorf("group name cannot contain '%s'", GROUP_SESS_DELIM))
+	case HostUnreachableError:
+		return withExitCode(ExitUnreachable, fmt.Errorf("%s", errMsg))
+	default:
+		return fmt.Errorf("%s", errMsg)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/andreatulimiero/i3tmux
 go 1.15
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/kevinburke/ssh_config v1.1.0
 	go.i3wm.org/i3/v4 v4.18.0
 	golang.org/x/crypto v0.0.0-20210317152858-513c2a44f670
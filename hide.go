@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"go.i3wm.org/i3/v4"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	HIDE_TO_SCRATCHPAD = "scratchpad"
+	// Marks starting with _ are not shown in titles
+	HIDDEN_MARK_PREFIX = "_i3tmux_hidden"
+)
+
+// isOpenWorkspace tells whether ws is a workspace whose windows count as
+// open, that is neither an i3 internal one, e.g., the scratchpad, nor the
+// one groups are hidden to
+func isOpenWorkspace(ws *i3.Node) bool {
+	return ws.Type == i3.WorkspaceNode && !strings.HasPrefix(ws.Name, "__") &&
+		(pref.HideTo == HIDE_TO_SCRATCHPAD || ws.Name != pref.HideTo)
+}
+
+// HiddenCon is a container hidden along with its group
+type HiddenCon struct {
+	ID        i3.NodeID
+	Mark      string
+	Idx       int
+	Floating  bool
+	Workspace string // the container was on
+}
+
+// groupKey identifies the windows of group on host, or of group
+// on any host if host is empty
+func groupKey(group, host string) string {
+	if host == "" {
+		return group
+	}
+	return group + HOST_DELIM + host
+}
+
+// hiddenMark returns the mark of the idx-th container hidden with the
+// windows of group key. Workspace names may contain spaces, so it goes last.
+func hiddenMark(key string, idx int, floating bool, workspace string) string {
+	return fmt.Sprintf("%s %s %d %t %s", HIDDEN_MARK_PREFIX, key, idx, floating, workspace)
+}
+
+func parseHiddenMark(mark string) (key string, con HiddenCon, ok bool) {
+	split := strings.SplitN(mark, " ", 5)
+	if len(split) != 5 || split[0] != HIDDEN_MARK_PREFIX {
+		return "", con, false
+	}
+	idx, err := strconv.Atoi(split[2])
+	if err != nil {
+		return "", con, false
+	}
+	floating, err := strconv.ParseBool(split[3])
+	if err != nil {
+		return "", con, false
+	}
+	return split[1], HiddenCon{Mark: mark, Idx: idx, Floating: floating, Workspace: split[4]}, true
+}
+
+// hideTargets returns the containers to move to hide the sessions of group
+// on host in u, that is the outermost ones holding nothing else, and
+// whether u holds nothing else
+func hideTargets(u *i3.Node, group, host string) ([]*i3.Node, bool) {
+	if nodeIsLeaf(u) {
+		h, g, _, err := deserializeHostGroupSessFromCon(u)
+		if err == nil && g == group && (host == "" || h == host) {
+			return []*i3.Node{u}, true
+		}
+		// Empty containers, e.g. placeholders, are neither
+		return nil, u.Window == 0
+	}
+	var targets []*i3.Node
+	only := true
+	for _, v := range u.Nodes {
+		vTargets, vOnly := hideTargets(v, group, host)
+		targets = append(targets, vTargets...)
+		only = only && vOnly
+	}
+	if only && len(targets) > 0 {
+		return []*i3.Node{u}, true
+	}
+	return targets, only
+}
+
+// getHiddenCons returns the containers hidden with the windows of group
+// key in tree, in the order they were hidden
+func getHiddenCons(tree *i3.Tree, key string) []HiddenCon {
+	var hidden []HiddenCon
+	tree.Root.FindChild(func(n *i3.Node) bool {
+		for _, mark := range n.Marks {
+			if k, con, ok := parseHiddenMark(mark); ok && k == key {
+				con.ID = n.ID
+				hidden = append(hidden, con)
+			}
+		}
+		return false
+	})
+	sort.Slice(hidden, func(i, j int) bool {
+		return hidden[i].Idx < hidden[j].Idx
+	})
+	return hidden
+}
+
+// hideGroup moves the windows of group on host, or on any host if host
+// is empty, to the scratchpad or to the hidden workspace preferred.
+// Each container moved is marked to be shown back where it was.
+func hideGroup(tree *i3.Tree, group, host string) error {
+	key := groupKey(group, host)
+	idx := len(getHiddenCons(tree, key))
+	move := "move scratchpad"
+	if pref.HideTo != HIDE_TO_SCRATCHPAD {
+		move = "move container to workspace " + i3Quote(pref.HideTo)
+	}
+
+	hidden := 0
+	var err error
+	tree.Root.FindChild(func(ws *i3.Node) bool {
+		if !isOpenWorkspace(ws) {
+			return false
+		}
+		hide := func(cons []*i3.Node, floating bool) bool {
+			for _, con := range cons {
+				mark := hiddenMark(key, idx, floating, ws.Name)
+				_, err = i3.RunCommand(fmt.Sprintf("[con_id=%d] mark --add %s, %s", con.ID, i3Quote(mark), move))
+				if err != nil {
+					return true
+				}
+				idx++
+				hidden++
+			}
+			return false
+		}
+		for _, v := range ws.Nodes {
+			targets, _ := hideTargets(v, group, host)
+			if hide(targets, false) {
+				return true
+			}
+		}
+		for _, f := range ws.FloatingNodes {
+			for _, v := range f.Nodes {
+				targets, _ := hideTargets(v, group, host)
+				if hide(targets, true) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return withExitCode(ExitI3, fmt.Errorf("hiding %s: %w", key, err))
+	}
+	if hidden == 0 {
+		return withExitCode(ExitNotFound, fmt.Errorf("no window of %s to hide", key))
+	}
+	return nil
+}
+
+// showGroup moves the containers hidden with the windows of group on host
+// back to the workspaces they were on, or to the focused one if here
+func showGroup(tree *i3.Tree, group, host string, here bool) error {
+	key := groupKey(group, host)
+	hidden := getHiddenCons(tree, key)
+	if len(hidden) == 0 {
+		return withExitCode(ExitNotFound, fmt.Errorf("%s is not hidden", key))
+	}
+	focused, err := getFocusedWs(tree)
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	workspace := focused.Name
+	for _, con := range hidden {
+		if !here {
+			workspace = con.Workspace
+		}
+		cmd := fmt.Sprintf("[con_id=%d] move container to workspace %s", con.ID, i3Quote(workspace))
+		if !con.Floating {
+			// Containers in the scratchpad are floating
+			cmd += ", floating disable"
+		}
+		cmd += ", unmark " + i3Quote(con.Mark)
+		if _, err := i3.RunCommand(cmd); err != nil {
+			return withExitCode(ExitI3, fmt.Errorf("showing %s: %w", key, err))
+		}
+	}
+	if workspace != focused.Name {
+		if _, err := i3.RunCommand("workspace " + i3Quote(workspace)); err != nil {
+			return withExitCode(ExitI3, err)
+		}
+	}
+	return nil
+}
+
+func hideAction() error {
+	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	host, group, _, err := getFocusedSession(&tree)
+	if err != nil {
+		return err
+	}
+	if err := hideGroup(&tree, group, layoutHostOf(group, host)); err != nil {
+		return err
+	}
+	notifySuccess("Hid group", group+HOST_DELIM+host)
+	return nil
+}
+
+func showAction(group, host string) error {
+	hosts, err := hostsOfGroup(group, host)
+	if err != nil {
+		return err
+	}
+	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	return showGroup(&tree, group, layoutHostOf(group, hosts[0]), false)
+}
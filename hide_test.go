@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHiddenMark(t *testing.T) {
+	tests := []struct {
+		key       string
+		idx       int
+		floating  bool
+		workspace string
+	}{
+		{"g@h", 0, false, "1"},
+		{"g", 3, true, "2:web dev"},
+	}
+	for _, test := range tests {
+		mark := hiddenMark(test.key, test.idx, test.floating, test.workspace)
+		key, con, ok := parseHiddenMark(mark)
+		if !ok {
+			t.Errorf("%q not parsed", mark)
+			continue
+		}
+		if key != test.key || con.Idx != test.idx || con.Floating != test.floating ||
+			con.Workspace != test.workspace || con.Mark != mark {
+			t.Errorf("%q parsed as %q %+v", mark, key, con)
+		}
+	}
+}
+
+func TestParseHiddenMarkInvalid(t *testing.T) {
+	for _, mark := range []string{
+		"editor",
+		HIDDEN_MARK_PREFIX + " g@h 0 false",
+		HIDDEN_MARK_PREFIX + " g@h x false 1",
+		HIDDEN_MARK_PREFIX + " g@h 0 maybe 1",
+		PENDING_MARK_PREFIX + " g@h 0 false 1",
+	} {
+		if _, _, ok := parseHiddenMark(mark); ok {
+			t.Errorf("%q parsed", mark)
+		}
+	}
+}
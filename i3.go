@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"go.i3wm.org/i3/v4"
+	"log"
+	"regexp"
+	"strings"
 )
 
 func getFocusedWs(tree *i3.Tree) (*i3.Node, error) {
@@ -27,69 +30,321 @@ func getFocusedCon(tree *i3.Tree) (*i3.Node, error) {
 	return con, nil
 }
 
+// getFocusedSession returns host, group and session of the focused window
+func getFocusedSession(tree *i3.Tree) (string, string, string, error) {
+	con, err := getFocusedCon(tree)
+	if err != nil {
+		return "", "", "", withExitCode(ExitI3, err)
+	}
+	host, group, session, err := deserializeHostGroupSessFromCon(con)
+	if err != nil {
+		return "", "", "", withExitCode(ExitI3,
+			fmt.Errorf("focused window is not an i3tmux session: %w", err))
+	}
+	return host, group, session, nil
+}
+
+// getOpenSessions returns the sessions with a window in the local i3 tree,
+// serialized as their instance
+func getOpenSessions() map[string]bool {
+	open := make(map[string]bool)
+	tree, err := i3.GetTree()
+	if err != nil {
+		// Without i3 no session is open locally
+		return open
+	}
+	tree.Root.FindChild(func(n *i3.Node) bool {
+		if !nodeIsLeaf(n) {
+			return false
+		}
+		host, group, session, err := deserializeHostGroupSessFromCon(n)
+		if err == nil {
+			open[serializeHostGroupSess(host, group, session)] = true
+		}
+		return false
+	})
+	return open
+}
+
+// getOpenWindows returns the properties of the windows in tree
+func getOpenWindows(tree *i3.Tree) []i3.WindowProperties {
+	var windows []i3.WindowProperties
+	tree.Root.FindChild(func(n *i3.Node) bool {
+		if n.Window != 0 {
+			windows = append(windows, n.WindowProperties)
+		}
+		return false
+	})
+	return windows
+}
+
 func nodeIsLeaf(n *i3.Node) bool {
 	return n.Type == i3.Con && len(n.Nodes) == 0
 }
 
-// getTreeOfGroupSess traverses the tree of nodes u
-// looking for i3tmux sessions
-// FIXME: look for windows beloning to a host only
-func getTreeOfGroupSess(u *i3.Node) map[string]interface{} {
+// otherWindowLayout returns a placeholder swallowing the window of
+// leaf u by its class and instance, or nil if u holds no window
+func otherWindowLayout(u *i3.Node) map[string]interface{} {
+	props := u.WindowProperties
+	if u.Window == 0 || (props.Class == "" && props.Instance == "") {
+		return nil
+	}
+	criteria := make(map[string]string)
+	if props.Class != "" {
+		criteria["class"] = "^" + regexp.QuoteMeta(props.Class) + "$"
+	}
+	if props.Instance != "" {
+		criteria["instance"] = "^" + regexp.QuoteMeta(props.Instance) + "$"
+	}
+	m := make(map[string]interface{})
+	m["type"] = i3.Con
+	m["percent"] = u.Percent
+	m["swallows"] = []map[string]string{criteria}
+	return m
+}
+
+// Marks i3tmux sets for itself start with it
+const I3TMUX_MARK_PREFIX = "_i3tmux"
+
+// setConAttrs records in m the attributes of container u that
+// append_layout restores: border, marks but those of i3tmux and
+// fullscreen mode
+func setConAttrs(m map[string]interface{}, u *i3.Node) {
+	if u.Border != "" {
+		m["border"] = u.Border
+		m["current_border_width"] = u.CurrentBorderWidth
+	}
+	var marks []string
+	for _, mark := range u.Marks {
+		if !strings.HasPrefix(mark, I3TMUX_MARK_PREFIX) {
+			marks = append(marks, mark)
+		}
+	}
+	if len(marks) > 0 {
+		m["marks"] = marks
+	}
+	if u.FullscreenMode != i3.FullscreenNone {
+		m["fullscreen_mode"] = u.FullscreenMode
+	}
+}
+
+// getTreeOfGroupSess traverses the tree of nodes u looking for the
+// sessions of group on host, or on any host if host is empty.
+// With keepOthers, other windows are recorded as placeholders too
+// and the structure of containers is kept.
+func getTreeOfGroupSess(u *i3.Node, group, host string, keepOthers bool) map[string]interface{} {
 	if nodeIsLeaf(u) {
-		host, group, session, err := deserializeHostGroupSessFromCon(u)
-		if err != nil {
+		h, g, session, err := deserializeHostGroupSessFromCon(u)
+		if err != nil || g != group || (host != "" && h != host) {
+			if keepOthers {
+				return otherWindowLayout(u)
+			}
 			// We care about tmux session leaves only
 			return nil
 		}
 		m := make(map[string]interface{})
 		m["type"] = i3.Con
-		m["swallows"] = []map[string]string{{"instance": serializeHostGroupSess(host, group, session)}}
+		if keepOthers {
+			m["percent"] = u.Percent
+		}
+		m["name"] = u.Name
+		setConAttrs(m, u)
+		m["swallows"] = []map[string]string{{"instance": serializeHostGroupSess(h, g, session)}}
 		return m
 	} else {
 		var nodes []map[string]interface{}
 		for _, v := range u.Nodes {
-			sessionNodes := getTreeOfGroupSess(v)
+			sessionNodes := getTreeOfGroupSess(v, group, host, keepOthers)
 			if sessionNodes == nil {
 				continue
 			}
 			nodes = append(nodes, sessionNodes)
 		}
-		switch len(nodes) {
-		case 0:
+		switch {
+		case len(nodes) == 0:
 			// No child contains a session, skip this
 			return nil
-		case 1:
+		case len(nodes) == 1 && !keepOthers:
 			// Optimize out self and return the only child
-			// TODO: Make this an option. If optimization is not done it should
-			//       be easier to recreate an entire workspace layout with other
-			//       applications (e.g., browser)
 			return nodes[0]
 		default:
 			m := make(map[string]interface{})
 			m["layout"] = u.Layout
 			m["type"] = i3.Con
 			m["percent"] = u.Percent
+			setConAttrs(m, u)
 			m["nodes"] = nodes
 			return m
 		}
 	}
 }
 
-func closeGroupSessWindows(u *i3.Node, group *string) error {
-	for _, v := range u.Nodes {
-		err := closeGroupSessWindows(v, group)
+// getFloatingOfGroupSess returns a floating_con for each floating window
+// of the sessions of group on host in workspace ws, along with its geometry
+func getFloatingOfGroupSess(ws *i3.Node, group, host string, keepOthers bool) []map[string]interface{} {
+	var floating []map[string]interface{}
+	for _, f := range ws.FloatingNodes {
+		var nodes []map[string]interface{}
+		for _, v := range f.Nodes {
+			if sessionNodes := getTreeOfGroupSess(v, group, host, keepOthers); sessionNodes != nil {
+				nodes = append(nodes, sessionNodes)
+			}
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		m := make(map[string]interface{})
+		m["type"] = i3.FloatingCon
+		m["rect"] = f.Rect
+		setConAttrs(m, f)
+		m["nodes"] = nodes
+		floating = append(floating, m)
+	}
+	return floating
+}
+
+// hasGroupSess tells whether some leaf of u is a session of group on host,
+// or on any host if host is empty
+func hasGroupSess(u *i3.Node, group, host string) bool {
+	return u.FindChild(func(n *i3.Node) bool {
+		if !nodeIsLeaf(n) {
+			return false
+		}
+		h, g, _, err := deserializeHostGroupSessFromCon(n)
+		return err == nil && g == group && (host == "" || h == host)
+	}) != nil
+}
+
+// getGroupLayout returns the layout of the sessions of group on host, or
+// on any host if host is empty, in each workspace of tree they are in,
+// or in its own workspace only if it has one. The focused workspace
+// comes last, so that it is focused once resumed.
+func getGroupLayout(tree *i3.Tree, group, host string, keepOthers bool) (*GroupLayout, error) {
+	focused, err := getFocusedWs(tree)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := i3.GetWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[i3.NodeID]i3.Workspace)
+	for _, w := range workspaces {
+		infos[w.ID] = w
+	}
+
+	layout := &GroupLayout{}
+	var focusedLayout *WorkspaceLayout
+	tree.Root.FindChild(func(n *i3.Node) bool {
+		if !isOpenWorkspace(n) {
+			// Hidden groups are not saved
+			return false
+		}
+		if !hasGroupSess(n, group, host) {
+			return false
+		}
+		wsLayout := WorkspaceLayout{
+			Workspace: n.Name,
+			Output:    infos[n.ID].Output,
+			Layout:    getTreeOfGroupSess(n, group, host, keepOthers),
+			Floating:  getFloatingOfGroupSess(n, group, host, keepOthers),
+		}
+		if n.ID == focused.ID {
+			focusedLayout = &wsLayout
+		} else {
+			layout.Workspaces = append(layout.Workspaces, wsLayout)
+		}
+		return false
+	})
+	if focusedLayout != nil {
+		layout.Workspaces = append(layout.Workspaces, *focusedLayout)
+	}
+	if name := groupWorkspace(group, host); name != "" {
+		for _, ws := range layout.Workspaces {
+			if ws.Workspace == name {
+				layout.Workspaces = []WorkspaceLayout{ws}
+				break
+			}
+		}
+	}
+	// Save exactly the workspace of the group, if it has one
+	return layout, nil
+}
+
+// closeGroupSessWindows closes the windows of the sessions of group on
+// host, or on any host if host is empty, in the tree of nodes u.
+// They are marked so that the server knows i3tmux closed them.
+func closeGroupSessWindows(u *i3.Node, group, host string) error {
+	for _, v := range append(u.Nodes, u.FloatingNodes...) {
+		err := closeGroupSessWindows(v, group, host)
 		if err != nil {
 			return err
 		}
 	}
-	_, g, _, err := deserializeHostGroupSessFromCon(u)
-	if err != nil || g != *group {
+	h, g, _, err := deserializeHostGroupSessFromCon(u)
+	if err != nil || g != group || (host != "" && h != host) {
 		return nil
 		// Just skip container since not targeted
 	}
-	_, err = i3.RunCommand(fmt.Sprintf("[con_id=%d] kill", u.ID))
+	_, err = i3.RunCommand(fmt.Sprintf("[con_id=%d] mark --add %s, kill", u.ID, closeMark(u.ID)))
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// i3Quote quotes s as an argument of i3 commands
+func i3Quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// focusWorkspace switches to workspace name, creating it on output
+// if it doesn't exist. The focused output is used if output is gone.
+func focusWorkspace(name, output string) error {
+	cmd := fmt.Sprintf("workspace %s", i3Quote(name))
+	if output != "" {
+		outputs, err := i3.GetOutputs()
+		if err != nil {
+			return withExitCode(ExitI3, err)
+		}
+		active := false
+		for _, o := range outputs {
+			active = active || (o.Name == output && o.Active)
+		}
+		if active {
+			cmd = fmt.Sprintf("focus output %s; %s", i3Quote(output), cmd)
+		} else {
+			log.Printf("Output %s of workspace %s is gone, using the focused one", output, name)
+		}
+	}
+	if _, err := i3.RunCommand(cmd); err != nil {
+		return withExitCode(ExitI3, fmt.Errorf("focusing workspace %s: %w", name, err))
+	}
+	return nil
+}
+
+// groupWorkspace returns the workspace dedicated to group on host, or on
+// any host if host is empty, empty if it has none
+func groupWorkspace(group, host string) string {
+	if ws, ok := pref.Workspaces[groupKey(group, host)]; ok {
+		return ws
+	}
+	if ws, ok := pref.Workspaces[group]; ok {
+		return ws
+	}
+	if pref.GroupWorkspaces {
+		return groupKey(group, host)
+	}
+	return ""
+}
+
+// focusGroupWorkspace switches to the workspace dedicated to group on host,
+// if any, and tells whether it did
+func focusGroupWorkspace(group, host string) (bool, error) {
+	ws := groupWorkspace(group, host)
+	if ws == "" {
+		return false, nil
+	}
+	return true, focusWorkspace(ws, "")
+}
@@ -0,0 +1,707 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.i3wm.org/i3/v4"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	LAYOUT_LATEST          = "latest"          // name of the layout saved by the last detach
+	LAYOUT_TS_FMT          = "20060102T150405" // names of the layouts in the history
+	LAYOUT_HISTORY_DEFAULT = 10
+)
+
+var layoutNameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// layoutPath returns the file the layout of group on host is saved to.
+// Groups spanning multiple hosts are saved without host.
+func layoutPath(group, host string) string {
+	if host == "" {
+		return path.Join(DATA_DIR, group+".json")
+	}
+	return path.Join(DATA_DIR, group+HOST_DELIM+host+".json")
+}
+
+// migrateLegacyLayout moves the layout of group saved without host, as
+// layouts used to be, to host: the first host the group is looked up for
+// takes it, unless it is the layout of a group spanning multiple hosts
+func migrateLegacyLayout(group, host string) {
+	if host == "" || layoutHostOf(group, host) == "" {
+		return
+	}
+	p := layoutPath(group, host)
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		return
+	}
+	if err := os.Rename(layoutPath(group, ""), p); err == nil {
+		log.Printf("Moved layout of %s to %s", group, p)
+	}
+}
+
+// layoutsDir returns the directory the named and past layouts
+// of group on host are kept in
+func layoutsDir(group, host string) string {
+	return strings.TrimSuffix(layoutPath(group, host), ".json")
+}
+
+func isLayoutTimestamp(name string) bool {
+	_, err := time.ParseInLocation(LAYOUT_TS_FMT, name, time.Local)
+	return err == nil
+}
+
+func validateLayoutName(name string) error {
+	if name == LAYOUT_LATEST || !layoutNameRe.MatchString(name) {
+		return usageErrorf("invalid layout name %s, it must start with a letter "+
+			"and only contain letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// savedLayoutPath returns the file of the layout of group on host called
+// name, that is either a saved name or the timestamp of a past layout
+func savedLayoutPath(group, host, name string) (string, error) {
+	migrateLegacyLayout(group, host)
+	if name == "" || name == LAYOUT_LATEST {
+		return layoutPath(group, host), nil
+	}
+	if !isLayoutTimestamp(name) {
+		if err := validateLayoutName(name); err != nil {
+			return "", err
+		}
+	}
+	return path.Join(layoutsDir(group, host), name+".json"), nil
+}
+
+// saveLayout saves j as the latest layout of group on host,
+// and keeps a copy of it in the history
+func saveLayout(group, host string, j []byte) error {
+	migrateLegacyLayout(group, host)
+	if err := ioutil.WriteFile(layoutPath(group, host), j, 0644); err != nil {
+		return err
+	}
+	dir := layoutsDir(group, host)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ts := time.Now().Format(LAYOUT_TS_FMT)
+	if err := ioutil.WriteFile(path.Join(dir, ts+".json"), j, 0644); err != nil {
+		return err
+	}
+	return pruneLayoutHistory(dir)
+}
+
+// saveNamedLayout saves j as the layout of group on host called name
+func saveNamedLayout(group, host, name string, j []byte) error {
+	if err := validateLayoutName(name); err != nil {
+		return err
+	}
+	dir := layoutsDir(group, host)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, name+".json"), j, 0644)
+}
+
+// pruneLayoutHistory removes the oldest layouts in dir beyond the
+// history size preferred
+func pruneLayoutHistory(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var history []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if isLayoutTimestamp(name) {
+			history = append(history, name)
+		}
+	}
+	sort.Strings(history)
+	for len(history) > pref.LayoutHistory {
+		if err := os.Remove(path.Join(dir, history[0]+".json")); err != nil {
+			return err
+		}
+		history = history[1:]
+	}
+	return nil
+}
+
+// SavedLayout describes a layout saved for a group
+type SavedLayout struct {
+	Name  string
+	Saved time.Time
+}
+
+// savedLayouts returns the layouts saved for group on host: the latest one
+// first, then the named ones and the history, most recent first
+func savedLayouts(group, host string) ([]SavedLayout, error) {
+	migrateLegacyLayout(group, host)
+	var layouts []SavedLayout
+	if fi, err := os.Stat(layoutPath(group, host)); err == nil {
+		layouts = append(layouts, SavedLayout{LAYOUT_LATEST, fi.ModTime()})
+	}
+	entries, err := ioutil.ReadDir(layoutsDir(group, host))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var named, history []SavedLayout
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || name == e.Name() {
+			continue
+		}
+		if isLayoutTimestamp(name) {
+			history = append(history, SavedLayout{name, e.ModTime()})
+		} else {
+			named = append(named, SavedLayout{name, e.ModTime()})
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Name > history[j].Name
+	})
+	layouts = append(layouts, named...)
+	return append(layouts, history...), nil
+}
+
+func printSavedLayouts(layouts []SavedLayout) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAYOUT\tSAVED")
+	for _, l := range layouts {
+		fmt.Fprintf(w, "%s\t%s\n", l.Name, l.Saved.Format(time.Stamp))
+	}
+	return w.Flush()
+}
+
+// layoutHostOf returns the host the layout of group is saved for:
+// none if group spans multiple hosts, host otherwise
+func layoutHostOf(group, host string) string {
+	manifest, err := getGroupManifest()
+	if err != nil {
+		return host
+	}
+	if hosts, ok := manifest[group]; ok && len(hosts) > 1 {
+		return ""
+	}
+	return host
+}
+
+// walkSwallows calls f on each swallow criteria of layout u
+func walkSwallows(u map[string]interface{}, f func(criteria map[string]interface{}) error) error {
+	if swallows, ok := u["swallows"].([]interface{}); ok {
+		for _, s := range swallows {
+			criteria, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if err := f(criteria); err != nil {
+				return err
+			}
+		}
+	}
+	for _, child := range layoutChildren(u) {
+		if err := walkSwallows(child, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteLayoutHost makes the swallow criteria of layout u
+// match the sessions on host
+func rewriteLayoutHost(u map[string]interface{}, host string) error {
+	return walkSwallows(u, func(criteria map[string]interface{}) error {
+		instance, ok := sessionOfCriteria(criteria)
+		if !ok {
+			return nil
+		}
+		_, group, session, err := deserializeHostGroupSessFromString(instance)
+		if err != nil {
+			return err
+		}
+		criteria["instance"] = serializeHostGroupSess(host, group, session)
+		return nil
+	})
+}
+
+// portableLayout makes layout u host and group neutral, by replacing
+// the instances in the swallow criteria with the bare session names
+// and dropping the titles of their windows
+func portableLayout(u map[string]interface{}) error {
+	dropSessionNames(u)
+	return walkSwallows(u, func(criteria map[string]interface{}) error {
+		instance, ok := sessionOfCriteria(criteria)
+		if !ok {
+			return nil
+		}
+		_, _, session, err := deserializeHostGroupSessFromString(instance)
+		if err != nil {
+			return err
+		}
+		delete(criteria, "instance")
+		criteria["session"] = session
+		return nil
+	})
+}
+
+// dropSessionNames drops the titles of the session windows in layout u,
+// which usually show the host, e.g. user@host:~/dir
+func dropSessionNames(u map[string]interface{}) {
+	if len(layoutInstances(u)) > 0 {
+		delete(u, "name")
+	}
+	for _, child := range layoutChildren(u) {
+		dropSessionNames(child)
+	}
+}
+
+// localizeLayout makes the swallow criteria of layout u, either portable
+// or saved for another group or host, match the sessions of group on host
+func localizeLayout(u map[string]interface{}, group, host string) error {
+	return walkSwallows(u, func(criteria map[string]interface{}) error {
+		session, ok := criteria["session"].(string)
+		if ok {
+			delete(criteria, "session")
+		} else if instance, ok := sessionOfCriteria(criteria); ok {
+			_, _, sess, err := deserializeHostGroupSessFromString(instance)
+			if err != nil {
+				return err
+			}
+			session = sess
+		} else {
+			return nil
+		}
+		if strings.Contains(session, GROUP_SESS_DELIM) || strings.Contains(session, HOST_DELIM) {
+			return fmt.Errorf("malformed session '%s'", session)
+		}
+		criteria["instance"] = serializeHostGroupSess(host, group, session)
+		return nil
+	})
+}
+
+// Placements of the sessions missing from a saved layout
+const (
+	PLACE_SPLIT = "split" // split next to the last container
+	PLACE_TAB   = "tab"   // in a tabbed container next to the layout
+	PLACE_NONE  = "none"  // wherever i3 puts them
+)
+
+// WorkspaceLayout is the layout of the windows of a group in a workspace
+type WorkspaceLayout struct {
+	// Workspace is recreated by name, which i3 takes its number from
+	Workspace string `json:"workspace,omitempty"`
+	// GroupWorkspace is set in portable layouts in place of Workspace
+	// if that was the workspace dedicated to the group
+	GroupWorkspace bool                   `json:"groupWorkspace,omitempty"`
+	Output         string                 `json:"output,omitempty"`
+	Layout         map[string]interface{} `json:"layout"`
+	// Floating holds a floating_con for each floating window
+	Floating []map[string]interface{} `json:"floating,omitempty"`
+}
+
+// GroupLayout is the layout of the windows of a group in each workspace
+type GroupLayout struct {
+	Workspaces []WorkspaceLayout `json:"workspaces"`
+}
+
+// parseGroupLayout parses j, either a group layout or a bare i3 layout
+// saved by older versions, to be appended to the focused workspace
+func parseGroupLayout(j []byte) (*GroupLayout, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(j, &m); err != nil {
+		return nil, fmt.Errorf("parsing layout: %w", err)
+	}
+	g := &GroupLayout{}
+	if _, ok := m["workspaces"]; ok {
+		if err := json.Unmarshal(j, g); err != nil {
+			return nil, fmt.Errorf("parsing layout: %w", err)
+		}
+		return g, nil
+	}
+	var layout map[string]interface{}
+	if err := json.Unmarshal(j, &layout); err != nil {
+		return nil, fmt.Errorf("parsing layout: %w", err)
+	}
+	g.Workspaces = []WorkspaceLayout{{Layout: layout}}
+	return g, nil
+}
+
+func readGroupLayout(p string) (*GroupLayout, error) {
+	j, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return parseGroupLayout(j)
+}
+
+// forEachLayout calls f on the tiling and floating layouts of each
+// workspace of g
+func (g *GroupLayout) forEachLayout(f func(u map[string]interface{}) error) error {
+	for _, ws := range g.Workspaces {
+		if ws.Layout != nil {
+			if err := f(ws.Layout); err != nil {
+				return err
+			}
+		}
+		for _, u := range ws.Floating {
+			if err := f(u); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Instances returns the instances of the sessions in g
+func (g *GroupLayout) Instances() map[string]bool {
+	instances := make(map[string]bool)
+	g.forEachLayout(func(u map[string]interface{}) error {
+		collectLayoutInstances(u, instances)
+		return nil
+	})
+	return instances
+}
+
+// Portable makes g, saved for group on host, host and group neutral.
+// It drops the outputs that belong to the local machine, and the name
+// of the workspace dedicated to the group, which usually holds both.
+func (g *GroupLayout) Portable(group, host string) error {
+	groupWs := groupWorkspace(group, host)
+	for i := range g.Workspaces {
+		ws := &g.Workspaces[i]
+		ws.Output = ""
+		if groupWs != "" && ws.Workspace == groupWs {
+			ws.Workspace, ws.GroupWorkspace = "", true
+		}
+	}
+	return g.forEachLayout(portableLayout)
+}
+
+// Localize makes g match the sessions of group on host, putting
+// in the workspace dedicated to the group those that were in the
+// one of the group exported
+func (g *GroupLayout) Localize(group, host string) error {
+	groupWs := groupWorkspace(group, host)
+	for i := range g.Workspaces {
+		ws := &g.Workspaces[i]
+		if ws.GroupWorkspace {
+			// Without one, they go to the focused workspace
+			ws.Workspace, ws.GroupWorkspace = groupWs, false
+		}
+	}
+	err := g.forEachLayout(func(u map[string]interface{}) error {
+		return localizeLayout(u, group, host)
+	})
+	if err != nil {
+		return err
+	}
+	if len(g.Instances()) == 0 {
+		return fmt.Errorf("no session found in layout")
+	}
+	return nil
+}
+
+func layoutChildren(u map[string]interface{}) []map[string]interface{} {
+	nodes, _ := u["nodes"].([]interface{})
+	children := make([]map[string]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		if child, ok := n.(map[string]interface{}); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+func setLayoutChildren(u map[string]interface{}, children []map[string]interface{}) {
+	nodes := make([]interface{}, len(children))
+	for i, c := range children {
+		nodes[i] = c
+	}
+	u["nodes"] = nodes
+}
+
+// sessionOfCriteria returns the instance of the i3tmux session the swallow
+// criteria match, if they are not those of another window
+func sessionOfCriteria(criteria map[string]interface{}) (string, bool) {
+	if _, ok := criteria["class"]; ok {
+		return "", false
+	}
+	instance, ok := criteria["instance"].(string)
+	return instance, ok
+}
+
+// layoutInstances returns the instances of the sessions the swallow
+// criteria of leaf u match
+func layoutInstances(u map[string]interface{}) []string {
+	swallows, _ := u["swallows"].([]interface{})
+	var instances []string
+	for _, s := range swallows {
+		criteria, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if instance, ok := sessionOfCriteria(criteria); ok {
+			instances = append(instances, instance)
+		}
+	}
+	return instances
+}
+
+// collectLayoutInstances adds the instances swallowed by the leaves of u to instances
+func collectLayoutInstances(u map[string]interface{}, instances map[string]bool) {
+	for _, instance := range layoutInstances(u) {
+		instances[instance] = true
+	}
+	for _, child := range layoutChildren(u) {
+		collectLayoutInstances(child, instances)
+	}
+}
+
+// scalePercents scales the percents of children so that they sum up to total
+func scalePercents(children []map[string]interface{}, total float64) {
+	sum := 0.0
+	for _, c := range children {
+		p, _ := c["percent"].(float64)
+		sum += p
+	}
+	for _, c := range children {
+		p, ok := c["percent"].(float64)
+		if !ok || sum == 0 {
+			c["percent"] = total / float64(len(children))
+			continue
+		}
+		c["percent"] = p / sum * total
+	}
+}
+
+// otherWindowOpen tells whether the swallow criteria of the placeholder
+// of another window u match one of windows, that would leave it empty
+func otherWindowOpen(u map[string]interface{}, windows []i3.WindowProperties) bool {
+	swallows, _ := u["swallows"].([]interface{})
+	for _, s := range swallows {
+		criteria, ok := s.(map[string]interface{})
+		if !ok || len(criteria) == 0 {
+			continue
+		}
+		for _, w := range windows {
+			props := map[string]string{
+				"class":       w.Class,
+				"instance":    w.Instance,
+				"title":       w.Title,
+				"window_role": w.Role,
+			}
+			match := true
+			for k, v := range criteria {
+				re, ok := v.(string)
+				if !ok {
+					match = false
+					break
+				}
+				matched, err := regexp.MatchString(re, props[k])
+				if err != nil || !matched {
+					match = false
+					break
+				}
+			}
+			if match {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneLayout removes from u the leaves swallowing sessions not in existing,
+// and the placeholders of other windows already open among windows, along
+// with the containers left empty. Containers left with a single child
+// are replaced by it. It returns nil if nothing is left.
+func pruneLayout(u map[string]interface{}, existing map[string]bool, windows []i3.WindowProperties) map[string]interface{} {
+	if instances := layoutInstances(u); len(instances) > 0 {
+		for _, instance := range instances {
+			if !existing[instance] {
+				return nil
+			}
+		}
+		return u
+	}
+	children := layoutChildren(u)
+	if len(children) == 0 {
+		// Placeholder of another window
+		if otherWindowOpen(u, windows) {
+			return nil
+		}
+		return u
+	}
+	var kept []map[string]interface{}
+	for _, child := range children {
+		if child = pruneLayout(child, existing, windows); child != nil {
+			kept = append(kept, child)
+		}
+	}
+	switch {
+	case len(kept) == 0:
+		return nil
+	case len(kept) == len(children):
+		// Keep the structure saved, with the children pruned
+		setLayoutChildren(u, kept)
+		return u
+	case len(kept) == 1:
+		child := kept[0]
+		if p, ok := u["percent"]; ok {
+			child["percent"] = p
+		} else {
+			delete(child, "percent")
+		}
+		return child
+	default:
+		scalePercents(kept, 1)
+		setLayoutChildren(u, kept)
+		return u
+	}
+}
+
+func newSessionLayout(instance string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "con",
+		"swallows": []interface{}{map[string]interface{}{"instance": instance}},
+	}
+}
+
+// placeNewSessions adds to layout u placeholders for instances as
+// placement tells. It returns the resulting layout.
+func placeNewSessions(u map[string]interface{}, instances []string, placement string) map[string]interface{} {
+	if len(instances) == 0 || placement == PLACE_NONE {
+		return u
+	}
+	var news []map[string]interface{}
+	for _, instance := range instances {
+		news = append(news, newSessionLayout(instance))
+	}
+	if placement == PLACE_TAB {
+		tabbed := map[string]interface{}{"type": "con", "layout": "tabbed"}
+		setLayoutChildren(tabbed, news)
+		news = []map[string]interface{}{tabbed}
+	}
+	if u == nil {
+		if len(news) == 1 {
+			return news[0]
+		}
+		split := map[string]interface{}{"type": "con", "layout": "splith"}
+		scalePercents(news, 1)
+		setLayoutChildren(split, news)
+		return split
+	}
+
+	if _, ok := u["nodes"]; !ok {
+		// Wrap a single session to split next to it
+		p, hasPercent := u["percent"]
+		split := map[string]interface{}{"type": "con", "layout": "splith"}
+		if hasPercent {
+			split["percent"] = p
+		}
+		u["percent"] = 1.0
+		setLayoutChildren(split, []map[string]interface{}{u})
+		u = split
+	}
+	children := layoutChildren(u)
+	total := float64(len(children)) / float64(len(children)+len(news))
+	scalePercents(children, total)
+	for _, n := range news {
+		n["percent"] = 1 / float64(len(children)+len(news))
+	}
+	setLayoutChildren(u, append(children, news...))
+	return u
+}
+
+// Reconcile makes g match instances, the sessions about to be launched:
+// it prunes the leaves of the others and of the other windows open among
+// windows, and places the missing sessions in the last workspace
+func (g *GroupLayout) Reconcile(instances []string, windows []i3.WindowProperties, placement string) {
+	existing := make(map[string]bool)
+	for _, instance := range instances {
+		existing[instance] = true
+	}
+	var kept []WorkspaceLayout
+	saved := make(map[string]bool)
+	// prune prunes u, returning nil if no session is left in it
+	prune := func(u map[string]interface{}) map[string]interface{} {
+		if u = pruneLayout(u, existing, windows); u == nil {
+			return nil
+		}
+		uSaved := make(map[string]bool)
+		collectLayoutInstances(u, uSaved)
+		if len(uSaved) == 0 {
+			// Placeholders of other windows only
+			return nil
+		}
+		for instance := range uSaved {
+			saved[instance] = true
+		}
+		return u
+	}
+	for _, ws := range g.Workspaces {
+		if ws.Layout != nil {
+			ws.Layout = prune(ws.Layout)
+		}
+		var floating []map[string]interface{}
+		for _, u := range ws.Floating {
+			if u = prune(u); u != nil {
+				floating = append(floating, u)
+			}
+		}
+		ws.Floating = floating
+		if ws.Layout == nil && len(ws.Floating) == 0 {
+			continue
+		}
+		kept = append(kept, ws)
+	}
+
+	var missing []string
+	for _, instance := range instances {
+		if !saved[instance] {
+			missing = append(missing, instance)
+		}
+	}
+	sort.Strings(missing)
+	if len(kept) == 0 {
+		if u := placeNewSessions(nil, missing, placement); u != nil {
+			kept = append(kept, WorkspaceLayout{Layout: u})
+		}
+	} else {
+		last := &kept[len(kept)-1]
+		last.Layout = placeNewSessions(last.Layout, missing, placement)
+	}
+	g.Workspaces = kept
+}
+
+// copyLayoutToHost copies the layout saved for group on srcHost to dstHost
+func copyLayoutToHost(group, srcHost, dstHost string) error {
+	p, err := savedLayoutPath(group, srcHost, "")
+	if err != nil {
+		return err
+	}
+	layout, err := readGroupLayout(p)
+	if err != nil {
+		return err
+	}
+	err = layout.forEachLayout(func(u map[string]interface{}) error {
+		return rewriteLayoutHost(u, dstHost)
+	})
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+	return saveLayout(group, dstHost, j)
+}
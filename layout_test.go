@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"go.i3wm.org/i3/v4"
+	"testing"
+)
+
+func mustLayout(t *testing.T, j string) map[string]interface{} {
+	t.Helper()
+	var u map[string]interface{}
+	if err := json.Unmarshal([]byte(j), &u); err != nil {
+		t.Fatalf("parsing %s: %s", j, err)
+	}
+	return u
+}
+
+// checkLayout compares the JSON of received with expected, regardless of
+// the order of keys and of spaces
+func checkLayout(t *testing.T, received interface{}, expected string) {
+	t.Helper()
+	var e interface{}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatalf("parsing %s: %s", expected, err)
+	}
+	ej, _ := json.Marshal(e)
+	rj, err := json.Marshal(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r interface{}
+	json.Unmarshal(rj, &r)
+	rj, _ = json.Marshal(r)
+	if string(rj) != string(ej) {
+		t.Errorf("expected:\n%s\nreceived:\n%s", ej, rj)
+	}
+}
+
+func TestPruneLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   string
+		existing []string
+		expected string
+	}{
+		{
+			"nothing pruned",
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.3, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.7, "swallows": [{"instance": "g_s1@h"}]}]}`,
+			[]string{"g_s0@h", "g_s1@h"},
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.3, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.7, "swallows": [{"instance": "g_s1@h"}]}]}`,
+		},
+		{
+			"killed session",
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.25, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.25, "swallows": [{"instance": "g_s1@h"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s2@h"}]}]}`,
+			[]string{"g_s0@h", "g_s1@h"},
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s1@h"}]}]}`,
+		},
+		{
+			"single child left",
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.5, "layout": "splitv", "nodes": [
+					{"percent": 0.5, "swallows": [{"instance": "g_s1@h"}]},
+					{"percent": 0.5, "swallows": [{"instance": "g_s2@h"}]}]}]}`,
+			[]string{"g_s0@h", "g_s2@h"},
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s2@h"}]}]}`,
+		},
+		{
+			"other window kept",
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"class": "^Firefox$"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]}]}`,
+			[]string{"g_s0@h"},
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"class": "^Firefox$"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]}]}`,
+		},
+		{
+			"all killed",
+			`{"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s1@h"}]}]}`,
+			nil,
+			`null`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			existing := make(map[string]bool)
+			for _, instance := range test.existing {
+				existing[instance] = true
+			}
+			checkLayout(t, pruneLayout(mustLayout(t, test.layout), existing, nil), test.expected)
+		})
+	}
+}
+
+func TestPlaceNewSessions(t *testing.T) {
+	leaf := `{"swallows": [{"instance": "g_s0@h"}]}`
+	tests := []struct {
+		name      string
+		layout    string
+		placement string
+		expected  string
+	}{
+		{
+			"split",
+			leaf,
+			PLACE_SPLIT,
+			`{"type": "con", "layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"type": "con", "percent": 0.5, "swallows": [{"instance": "g_s1@h"}]}]}`,
+		},
+		{
+			"tab",
+			leaf,
+			PLACE_TAB,
+			`{"type": "con", "layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"type": "con", "layout": "tabbed", "percent": 0.5, "nodes": [
+					{"type": "con", "swallows": [{"instance": "g_s1@h"}]}]}]}`,
+		},
+		{
+			"none",
+			leaf,
+			PLACE_NONE,
+			leaf,
+		},
+		{
+			"split of container",
+			`{"layout": "splitv", "nodes": [
+				{"percent": 0.25, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.75, "swallows": [{"instance": "g_s2@h"}]}]}`,
+			PLACE_SPLIT,
+			`{"layout": "splitv", "nodes": [
+				{"percent": 0.16666666666666666, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s2@h"}]},
+				{"type": "con", "percent": 0.3333333333333333, "swallows": [{"instance": "g_s1@h"}]}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := placeNewSessions(mustLayout(t, test.layout), []string{"g_s1@h"}, test.placement)
+			checkLayout(t, u, test.expected)
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name      string
+		layout    string
+		instances []string
+		windows   []i3.WindowProperties
+		placement string
+		expected  string
+	}{
+		{
+			"killed session",
+			`{"workspaces": [{"workspace": "1", "layout": {"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s1@h"}]}]}}]}`,
+			[]string{"g_s0@h"},
+			nil,
+			PLACE_SPLIT,
+			`{"workspaces": [{"workspace": "1", "layout": {"swallows": [{"instance": "g_s0@h"}]}}]}`,
+		},
+		{
+			"other windows only left",
+			`{"workspaces": [
+				{"workspace": "1", "layout": {"layout": "splith", "nodes": [
+					{"percent": 0.5, "swallows": [{"class": "^Firefox$"}]},
+					{"percent": 0.5, "swallows": [{"instance": "g_s1@h"}]}]}},
+				{"workspace": "2", "layout": {"swallows": [{"instance": "g_s0@h"}]}}]}`,
+			[]string{"g_s0@h"},
+			nil,
+			PLACE_SPLIT,
+			`{"workspaces": [{"workspace": "2", "layout": {"swallows": [{"instance": "g_s0@h"}]}}]}`,
+		},
+		{
+			"other window open",
+			`{"workspaces": [{"workspace": "1", "layout": {"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"class": "^Firefox$", "instance": "^Navigator$"}]},
+				{"percent": 0.25, "swallows": [{"class": "^XTerm$"}]},
+				{"percent": 0.25, "swallows": [{"instance": "g_s0@h"}]}]}}]}`,
+			[]string{"g_s0@h"},
+			[]i3.WindowProperties{{Class: "Firefox", Instance: "Navigator"}, {Class: "Emacs"}},
+			PLACE_SPLIT,
+			`{"workspaces": [{"workspace": "1", "layout": {"layout": "splith", "nodes": [
+				{"percent": 0.5, "swallows": [{"class": "^XTerm$"}]},
+				{"percent": 0.5, "swallows": [{"instance": "g_s0@h"}]}]}}]}`,
+		},
+		{
+			"new session split",
+			`{"workspaces": [
+				{"workspace": "1", "layout": {"swallows": [{"instance": "g_s0@h"}]}},
+				{"workspace": "2", "layout": {"swallows": [{"instance": "g_s1@h"}]}}]}`,
+			[]string{"g_s0@h", "g_s1@h", "g_s2@h"},
+			nil,
+			PLACE_SPLIT,
+			`{"workspaces": [
+				{"workspace": "1", "layout": {"swallows": [{"instance": "g_s0@h"}]}},
+				{"workspace": "2", "layout": {"type": "con", "layout": "splith", "nodes": [
+					{"percent": 0.5, "swallows": [{"instance": "g_s1@h"}]},
+					{"type": "con", "percent": 0.5, "swallows": [{"instance": "g_s2@h"}]}]}}]}`,
+		},
+		{
+			"new sessions tabbed without saved ones",
+			`{"workspaces": [{"workspace": "1", "layout": {"swallows": [{"instance": "g_s0@h"}]}}]}`,
+			[]string{"g_s1@h", "g_s2@h"},
+			nil,
+			PLACE_TAB,
+			`{"workspaces": [{"layout": {"type": "con", "layout": "tabbed", "nodes": [
+				{"type": "con", "swallows": [{"instance": "g_s1@h"}]},
+				{"type": "con", "swallows": [{"instance": "g_s2@h"}]}]}}]}`,
+		},
+		{
+			"new session left to i3",
+			`{"workspaces": [{"workspace": "1", "layout": {"swallows": [{"instance": "g_s0@h"}]}}]}`,
+			[]string{"g_s0@h", "g_s1@h"},
+			nil,
+			PLACE_NONE,
+			`{"workspaces": [{"workspace": "1", "layout": {"swallows": [{"instance": "g_s0@h"}]}}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := parseGroupLayout([]byte(test.layout))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.Reconcile(test.instances, test.windows, test.placement)
+			checkLayout(t, g, test.expected)
+		})
+	}
+}
+
+func TestExportImportLayout(t *testing.T) {
+	defer func(saved Pref) { pref = saved }(pref)
+	pref.GroupWorkspaces = true
+
+	saved := `{"workspaces": [
+		{"workspace": "2", "output": "eDP-1", "layout": {"layout": "splith", "nodes": [
+			{"percent": 0.5, "swallows": [{"class": "^Firefox$", "instance": "^Navigator$"}]},
+			{"percent": 0.5, "name": "me@h:~", "swallows": [{"instance": "g_session1@h"}]}]}},
+		{"workspace": "g@h", "output": "HDMI-1", "layout":
+			{"name": "me@h:~/src", "marks": ["editor"], "swallows": [{"instance": "g_session0@h"}]},
+		 "floating": [{"type": "floating_con", "nodes": [
+			{"name": "me@h:/tmp", "swallows": [{"instance": "g_session2@h"}]}]}]}]}`
+	g, err := parseGroupLayout([]byte(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Portable("g", "h"); err != nil {
+		t.Fatal(err)
+	}
+	checkLayout(t, g, `{"workspaces": [
+		{"workspace": "2", "layout": {"layout": "splith", "nodes": [
+			{"percent": 0.5, "swallows": [{"class": "^Firefox$", "instance": "^Navigator$"}]},
+			{"percent": 0.5, "swallows": [{"session": "session1"}]}]}},
+		{"groupWorkspace": true, "layout":
+			{"marks": ["editor"], "swallows": [{"session": "session0"}]},
+		 "floating": [{"type": "floating_con", "nodes": [
+			{"swallows": [{"session": "session2"}]}]}]}]}`)
+
+	j, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err = parseGroupLayout(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Localize("other", "h2"); err != nil {
+		t.Fatal(err)
+	}
+	checkLayout(t, g, `{"workspaces": [
+		{"workspace": "2", "layout": {"layout": "splith", "nodes": [
+			{"percent": 0.5, "swallows": [{"class": "^Firefox$", "instance": "^Navigator$"}]},
+			{"percent": 0.5, "swallows": [{"instance": "other_session1@h2"}]}]}},
+		{"workspace": "other@h2", "layout":
+			{"marks": ["editor"], "swallows": [{"instance": "other_session0@h2"}]},
+		 "floating": [{"type": "floating_con", "nodes": [
+			{"swallows": [{"instance": "other_session2@h2"}]}]}]}]}`)
+}
+
+func TestLocalizeLayoutErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+	}{
+		{"no session", `{"workspaces": [{"layout": {"swallows": [{"class": "^Firefox$"}]}}]}`},
+		{"malformed session", `{"workspaces": [{"layout": {"swallows": [{"session": "a_b"}]}}]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := parseGroupLayout([]byte(test.layout))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Localize("g", "h"); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
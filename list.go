@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	FORMAT_PLAIN = "plain"
+	FORMAT_TABLE = "table"
+	FORMAT_JSON  = "json"
+)
+
+// markOpenSessions flags the sessions that have a window in the local i3 tree
+func markOpenSessions(infos []SessionInfo) {
+	open := getOpenSessions()
+	for i, info := range infos {
+		infos[i].Open = open[serializeHostGroupSess(info.Host, info.Group, info.Session)]
+	}
+}
+
+func sortSessionInfos(infos []SessionInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Session < b.Session
+	})
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// HostsList is the JSON listing of the sessions of several hosts,
+// along with the error of each host that could not be listed
+type HostsList struct {
+	Sessions    []SessionInfo     `json:"sessions"`
+	Unreachable map[string]string `json:"unreachable"`
+}
+
+// printSessionInfos prints the sessions sorted by group in the given format.
+// withHost tells whether sessions come from more than one host, and
+// unreachable, if not nil, holds the hosts that could not be listed.
+func printSessionInfos(infos []SessionInfo, format string, withHost bool, unreachable map[string]error) error {
+	sortSessionInfos(infos)
+	unreachableHosts := make([]string, 0, len(unreachable))
+	for host := range unreachable {
+		unreachableHosts = append(unreachableHosts, host)
+	}
+	sort.Strings(unreachableHosts)
+	switch format {
+	case FORMAT_PLAIN:
+		group := ""
+		for i, info := range infos {
+			if i == 0 || info.Group != group {
+				group = info.Group
+				fmt.Println(group + ":")
+			}
+			if withHost {
+				fmt.Printf("- %s%s%s\n", info.Session, HOST_DELIM, info.Host)
+			} else {
+				fmt.Printf("- %s\n", info.Session)
+			}
+		}
+		for _, host := range unreachableHosts {
+			fmt.Printf("%s%s: unreachable: %s\n", HOST_DELIM, host, unreachable[host])
+		}
+	case FORMAT_TABLE:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := "GROUP\tSESSION\tOPEN\tATTACHED\tWINDOWS\tCOMMAND\tACTIVITY\tCREATED"
+		if withHost {
+			header = "HOST\t" + header
+		}
+		fmt.Fprintln(w, header)
+		for _, info := range infos {
+			if withHost {
+				fmt.Fprintf(w, "%s\t", info.Host)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+				info.Group,
+				info.Session,
+				yesNo(info.Open),
+				info.Attached,
+				info.Windows,
+				info.Command,
+				info.Activity.Format(time.Stamp),
+				info.Created.Format(time.Stamp))
+		}
+		for _, host := range unreachableHosts {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\tunreachable: %s\t-\t-\n", host, unreachable[host])
+		}
+		return w.Flush()
+	case FORMAT_JSON:
+		if infos == nil {
+			infos = []SessionInfo{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if unreachable == nil {
+			return enc.Encode(infos)
+		}
+		list := HostsList{infos, make(map[string]string)}
+		for host, err := range unreachable {
+			list.Unreachable[host] = err.Error()
+		}
+		return enc.Encode(list)
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+	return nil
+}
+
+type hostInfos struct {
+	host  string
+	infos []SessionInfo
+	err   error
+}
+
+func fetchInfosOfHost(host string) ([]SessionInfo, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	res, err := client.RequestResponse(&RequestList{RequestBase{host}})
+	if err != nil {
+		return nil, err
+	}
+	errCode, errMsg := res.Error()
+	switch errCode {
+	case ErrOk:
+	case TmuxNoSessionsError:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s", errMsg)
+	}
+	infos := res.(*ResponseList).Infos
+	for i := range infos {
+		infos[i].Host = host
+	}
+	return infos, nil
+}
+
+// fetchInfosOfHosts lists the sessions of all hosts concurrently.
+// Hosts that fail or do not answer within the host timeout are
+// returned along with their error.
+func fetchInfosOfHosts(hosts []string) ([]SessionInfo, map[string]error) {
+	resCh := make(chan hostInfos, len(hosts))
+	for _, host := range hosts {
+		go func(host string) {
+			infos, err := fetchInfosOfHost(host)
+			resCh <- hostInfos{host, infos, err}
+		}(host)
+	}
+
+	var infos []SessionInfo
+	unreachable := make(map[string]error)
+	answered := make(map[string]bool)
+	timeout := time.After(pref.HostTimeout)
+	for len(answered) < len(hosts) {
+		select {
+		case res := <-resCh:
+			answered[res.host] = true
+			if res.err != nil {
+				unreachable[res.host] = res.err
+				continue
+			}
+			infos = append(infos, res.infos...)
+		case <-timeout:
+			for _, host := range hosts {
+				if !answered[host] {
+					unreachable[host] = fmt.Errorf("timed out after %s", pref.HostTimeout)
+				}
+			}
+			return infos, unreachable
+		}
+	}
+	return infos, unreachable
+}
+
+func listAllHosts() error {
+	hosts, err := getListedHosts()
+	if err != nil {
+		return err
+	}
+	infos, unreachable := fetchInfosOfHosts(hosts)
+	markOpenSessions(infos)
+	return printSessionInfos(infos, listFormat, true, unreachable)
+}
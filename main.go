@@ -2,14 +2,12 @@ package main
 
 import (
 	"encoding/json"
-	"flag"
 	"fmt"
 	"golang.org/x/term"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
-	"path"
 	"regexp"
 	"syscall"
 
@@ -21,19 +19,6 @@ var (
 )
 
 var (
-	terminalBinFlag  = flag.String("terminal", "", "the binary path of the terminal to use")
-	terminalNameFlag = flag.String("nameFlag", "", "the flag used by the terminal of choice"+
-		"to define the window instance name")
-	hostFlag     = flag.String("host", "", "remote host where tmux server runs")
-	sessionFlag  = flag.String("session", "", "session to attach shell to")
-	createCmd    = flag.String("create", "", "create new group")
-	addCmd       = flag.Bool("add", false, "add window to the current group")
-	listCmd      = flag.Bool("list", false, "list sessions groups")
-	resumeCmd    = flag.String("resume", "", "resume group")
-	detachCmd    = flag.Bool("detach", false, "detach current group")
-	killCmd      = flag.Bool("kill", false, "kill current session locally and remotely")
-	shellCmd     = flag.Bool("shell", false, "spawn shell for session")
-	serverCmd    = flag.Bool("server", false, "run i3tmux server")
 	sessionFmtRe = regexp.MustCompile(`^[a-zA-Z]*(\d+)$`)
 
 	pref Pref
@@ -42,7 +27,11 @@ var (
 type SessionsPerGroup map[string]Sessions
 type Sessions map[string]bool
 
-func createAction(group, host string) error {
+func createAction(group, host, cwd, cmd string) error {
+	hosts, err := hostsOfGroup(group, host)
+	if err != nil {
+		return err
+	}
 	client, err := newClient()
 	if err != nil {
 		return err
@@ -50,39 +39,68 @@ func createAction(group, host string) error {
 	defer client.Close()
 	// Create client
 
-	res, err := client.RequestResponse(&RequestCreate{RequestBase{host}, group})
-	if err != nil {
-		return err
-	}
-	errCode, errMsg := res.Error()
-	if errCode != ErrOk {
-		switch errCode {
-		case GroupAlreadyExistsError:
-			return fmt.Errorf("already exists")
-		default:
-			return fmt.Errorf("%s", errMsg)
+	created := 0
+	for _, host := range hosts {
+		res, err := client.RequestResponse(&RequestCreate{RequestBase{host}, group, cwd, cmd})
+		if err != nil {
+			return err
 		}
-	}
-	// Receive response
+		errCode, errMsg := res.Error()
+		if errCode == GroupAlreadyExistsError && len(hosts) > 1 {
+			// Left by a create that failed on another host, carry on with the others
+			log.Println("Sessions group already exists on", host)
+			continue
+		}
+		if err := responseError(errCode, errMsg); err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+		// Receive response
 
-	log.Println("Created new sessions group")
-	return res.Do(client, host)
+		log.Println("Created new sessions group on", host)
+		if err := res.Do(client, host); err != nil {
+			return err
+		}
+		created++
+	}
+	if created == 0 {
+		return responseError(GroupAlreadyExistsError, "")
+	}
+	_, err = focusGroupWorkspace(group, layoutHostOf(group, hosts[0]))
+	return err
 }
 
-func addAction() error {
-	// TODO: Add swallow container first to inform user operation is being performed?
-	tree, err := i3.GetTree()
-	if err != nil {
-		return err
-	}
-	con, err := getFocusedCon(&tree)
-	if err != nil {
-		return err
+// addAction adds a session to group on host, or to the group of the
+// focused window if group is empty
+func addAction(group, host, cwd, cmd string) (err error) {
+	session := ""
+	if group == "" {
+		tree, err := i3.GetTree()
+		if err != nil {
+			return withExitCode(ExitI3, err)
+		}
+		host, group, session, err = getFocusedSession(&tree)
+		if err != nil {
+			return err
+		}
+	} else {
+		hosts, err := hostsOfGroup(group, host)
+		if err != nil {
+			return err
+		}
+		host = hosts[0]
 	}
-	host, group, _, err := deserializeHostGroupSessFromCon(con)
-	if err != nil {
+
+	if _, err := focusGroupWorkspace(group, layoutHostOf(group, host)); err != nil {
 		return err
 	}
+	placeholder := pendingPlaceholder(fmt.Sprintf("Adding session to %s ...", group+HOST_DELIM+host),
+		sessionsInstanceRe(group, host))
+	defer func() {
+		if err != nil {
+			placeholder.Fail(err)
+		}
+	}()
+	// Show something is happening straight away, the terminal fills it once mapped
 
 	client, err := newClient()
 	if err != nil {
@@ -91,21 +109,27 @@ func addAction() error {
 	defer client.Close()
 	// Create client
 
-	res, err := client.RequestResponse(&RequestAdd{RequestBase{host}, group})
+	res, err := client.RequestResponse(&RequestAdd{RequestBase{host}, group, session, cwd, cmd})
 	if err != nil {
 		return err
 	}
-	errCode, errMsg := res.Error()
-	if errCode != ErrOk {
-		return fmt.Errorf("%s", errMsg)
+	if err := responseError(res.Error()); err != nil {
+		return err
 	}
 	// Receive response
 
-	return res.Do(client, host)
+	if err := res.Do(client, host); err != nil {
+		return err
+	}
+	resAdd := res.(*ResponseAdd)
+	notifySuccess("Added session", serializeHostGroupSess(host, resAdd.Group, resAdd.Session))
+	return nil
 }
 
 func listAction(host string) error {
-	fmt.Println("Retrieving available sessions groups ...")
+	if listFormat == FORMAT_PLAIN {
+		fmt.Println("Retrieving available sessions groups ...")
+	}
 	client, err := newClient()
 	if err != nil {
 		return err
@@ -113,6 +137,12 @@ func listAction(host string) error {
 	defer client.Close()
 	// Create client
 
+	if listAllHostsFlag {
+		return listAllHosts()
+	}
+	if host == "" {
+		return listManifestGroups(client)
+	}
 	res, err := client.RequestResponse(&RequestList{RequestBase{host}})
 	if err != nil {
 		return err
@@ -121,10 +151,13 @@ func listAction(host string) error {
 	if errCode != ErrOk {
 		switch errCode {
 		case TmuxNoSessionsError:
+			if listFormat != FORMAT_PLAIN {
+				return printSessionInfos(nil, listFormat, false, nil)
+			}
 			fmt.Println("No session found")
 			return nil
 		default:
-			return fmt.Errorf("%s", errMsg)
+			return responseError(errCode, errMsg)
 		}
 	}
 	// Receive response
@@ -132,42 +165,211 @@ func listAction(host string) error {
 	return res.Do(client, host)
 }
 
+// listManifestGroups lists the sessions of the groups in the manifest
+// asking each of the hosts they span
+func listManifestGroups(client *Client) error {
+	manifest, err := getGroupManifest()
+	if err != nil {
+		return err
+	}
+	if len(manifest) == 0 {
+		return usageErrorf("no host specified and no group in %s", GROUP_MANIFEST_FILE)
+	}
+	infosPerHost := make(map[string][]SessionInfo)
+	var infos []SessionInfo
+	for _, g := range manifest.Groups() {
+		for _, host := range manifest[g] {
+			hostInfos, ok := infosPerHost[host]
+			if !ok {
+				res, err := client.RequestResponse(&RequestList{RequestBase{host}})
+				if err != nil {
+					return err
+				}
+				errCode, errMsg := res.Error()
+				switch errCode {
+				case ErrOk:
+					hostInfos = res.(*ResponseList).Infos
+				case TmuxNoSessionsError:
+				default:
+					return fmt.Errorf("%s: %w", host, responseError(errCode, errMsg))
+				}
+				infosPerHost[host] = hostInfos
+			}
+			for _, info := range hostInfos {
+				if info.Group == g {
+					info.Host = host
+					infos = append(infos, info)
+				}
+			}
+		}
+	}
+	markOpenSessions(infos)
+	return printSessionInfos(infos, listFormat, true, nil)
+}
+
+// detachGroup saves the layout of the windows of group on host, or on any
+// host if host is empty, and closes the windows saved
+func detachGroup(tree *i3.Tree, group, host string) error {
+	layout, err := getGroupLayout(tree, group, host, pref.OtherWindows)
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	j, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+	err = saveLayout(group, host, j)
+	if err != nil {
+		return err
+	}
+	log.Printf("Saved layout for %s", groupKey(group, host))
+	root := tree.Root
+	if name := groupWorkspace(group, host); name != "" &&
+		len(layout.Workspaces) == 1 && layout.Workspaces[0].Workspace == name {
+		// Only the workspace of the group was saved, leave its windows elsewhere open
+		root = tree.Root.FindChild(func(n *i3.Node) bool {
+			return n.Type == i3.WorkspaceNode && n.Name == name
+		})
+	}
+	err = closeGroupSessWindows(root, group, host)
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	return nil
+}
+
 func detachAction() error {
 	tree, err := i3.GetTree()
 	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	host, group, _, err := getFocusedSession(&tree)
+	if err != nil {
+		return err
+	}
+	if err := detachGroup(&tree, group, layoutHostOf(group, host)); err != nil {
 		return err
 	}
-	con, err := getFocusedCon(&tree)
+	notifySuccess("Detached group", group+HOST_DELIM+host)
+	return nil
+}
+
+func saveLayoutAction(name string) error {
+	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	host, group, _, err := getFocusedSession(&tree)
 	if err != nil {
 		return err
 	}
-	host, group, _, err := deserializeHostGroupSessFromCon(con)
+	layout, err := getGroupLayout(&tree, group, layoutHostOf(group, host), pref.OtherWindows)
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	j, err := json.Marshal(layout)
 	if err != nil {
 		return err
 	}
-	ws, err := getFocusedWs(&tree)
+	err = saveNamedLayout(group, layoutHostOf(group, host), name, j)
 	if err != nil {
 		return err
 	}
-	groupSessLayout := getTreeOfGroupSess(ws)
-	j, err := json.Marshal(groupSessLayout)
+	log.Printf("Saved layout %s for %s@%s", name, group, host)
+	notifySuccess("Saved layout "+name, group+HOST_DELIM+host)
+	return nil
+}
+
+func layoutsAction(group, host string) error {
+	hosts, err := hostsOfGroup(group, host)
+	if err != nil {
+		return err
+	}
+	layouts, err := savedLayouts(group, layoutHostOf(group, hosts[0]))
+	if err != nil {
+		return err
+	}
+	if len(layouts) == 0 {
+		fmt.Println("No layout saved")
+		return nil
+	}
+	return printSavedLayouts(layouts)
+}
+
+func exportLayoutAction(group, host, name string) error {
+	hosts, err := hostsOfGroup(group, host)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(path.Join(DATA_DIR, group+".json"), j, 0644)
+	layoutHost := layoutHostOf(group, hosts[0])
+	p, err := savedLayoutPath(group, layoutHost, name)
 	if err != nil {
 		return err
 	}
-	log.Printf("Saved layout for %s@%s", group, host)
-	err = closeGroupSessWindows(ws, &group)
+	layout, err := readGroupLayout(p)
 	if err != nil {
-		log.Fatal(err)
+		if os.IsNotExist(err) {
+			return withExitCode(ExitNotFound, fmt.Errorf("no layout saved for %s", group))
+		}
+		return err
+	}
+	if err := layout.Portable(group, layoutHost); err != nil {
+		return err
 	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(layout)
+}
+
+func importLayoutAction(group, host, name string) error {
+	hosts, err := hostsOfGroup(group, host)
+	if err != nil {
+		return err
+	}
+	if len(hosts) > 1 {
+		return usageErrorf("%s spans multiple hosts, specify the one to import for with -host", group)
+	}
+	j, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	layout, err := parseGroupLayout(j)
+	if err != nil {
+		return err
+	}
+	if err := layout.Localize(group, hosts[0]); err != nil {
+		return err
+	}
+	j, err = json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+	layoutHost := layoutHostOf(group, hosts[0])
+	if name != "" {
+		err = saveNamedLayout(group, layoutHost, name, j)
+	} else {
+		err = saveLayout(group, layoutHost, j)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported layout for %s@%s", group, hosts[0])
 	return nil
 }
 
-func resumeAction(group, host string) error {
+func resumeAction(group, host string, opts ResumeOptions) (err error) {
 	fmt.Println("Resuming sessions ...")
+	hosts, err := hostsOfGroup(group, host)
+	if err != nil {
+		return err
+	}
+	placeholder := pendingPlaceholder(fmt.Sprintf("Resuming %s ...", group), "")
+	defer func() {
+		if err != nil {
+			placeholder.Fail(err)
+		}
+	}()
+	// Show something is happening until the layout is appended
 	client, err := newClient()
 	if err != nil {
 		return err
@@ -175,32 +377,93 @@ func resumeAction(group, host string) error {
 	defer client.Close()
 	// Create client
 
-	res, err := client.RequestResponse(&RequestResume{RequestBase{host}, group})
-	if err != nil {
-		return err
+	if len(hosts) == 1 {
+		host := hosts[0]
+		res, err := client.RequestResponse(&RequestResume{RequestBase{host}, group, opts.Mode})
+		if err != nil {
+			return err
+		}
+		if err := responseError(res.Error()); err != nil {
+			return err
+		}
+		// Receive response
+		if err := placeholder.Close(); err != nil {
+			return withExitCode(ExitI3, err)
+		}
+		resResume := res.(*ResponseResume)
+		resResume.opts = opts
+		return resResume.Do(client, host)
 	}
-	errCode, errMsg := res.Error()
-	if errCode != ErrOk {
+
+	resPerHost := make(map[string]*ResponseResume)
+	for _, host := range hosts {
+		res, err := client.RequestResponse(&RequestResume{RequestBase{host}, group, opts.Mode})
+		if err != nil {
+			return err
+		}
+		errCode, errMsg := res.Error()
 		switch errCode {
-		case TmuxNoSessionsError:
-			log.Println("No sessions found")
-			return nil
+		case ErrOk:
+			resPerHost[host] = res.(*ResponseResume)
+		case TmuxNoSessionsError, GroupNotFoundError:
+			log.Printf("No sessions of %s found on %s", group, host)
 		default:
-			return fmt.Errorf("%s", errMsg)
+			return fmt.Errorf("%s: %w", host, responseError(errCode, errMsg))
 		}
 	}
-	// Receive response
-	return res.Do(client, host)
+	if len(resPerHost) == 0 {
+		return responseError(GroupNotFoundError, "")
+	}
+	// Collect the sessions of the group from each host
+
+	open := getOpenSessions()
+	isOpen := false
+	toLaunchPerHost := make(map[string]map[string]AttachMode)
+	var instances []string
+	for host, res := range resPerHost {
+		isOpen = isOpen || res.IsOpen(host, open)
+		toLaunchPerHost[host] = res.SessionsToLaunch(host, open)
+		instances = append(instances, res.Instances(host, toLaunchPerHost[host])...)
+	}
+	if err := placeholder.Close(); err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	if !opts.Here {
+		if _, err := focusGroupWorkspace(group, ""); err != nil {
+			return err
+		}
+	}
+	if !isOpen {
+		if err := appendSavedLayout(group, "", instances, opts); err != nil {
+			return err
+		}
+	}
+	for host, res := range resPerHost {
+		if err := res.LaunchTerms(host, toLaunchPerHost[host]); err != nil {
+			return err
+		}
+	}
+	// Resume a single layout for the sessions of all hosts
+	return nil
 }
 
-func shellAction(session, host string) error {
+func shellAction(session, host string, mode AttachMode) error {
 	client, err := newClient()
 	if err != nil {
-		return fmt.Errorf("creating client: %w", err)
+		return err
 	}
 	defer client.Close()
 	// Create client
 
+	if tag := mode.TitleTag(); tag != "" {
+		instance := regexp.QuoteMeta(session + HOST_DELIM + host)
+		_, err := i3.RunCommand(fmt.Sprintf(`[instance="^%s$"] title_format "[%s] %%title"`, instance, tag))
+		if err != nil {
+			log.Println("Error marking title of", session, err)
+		}
+	}
+	// Mark windows attached to sessions shared with others
+
 	w, h, err := term.GetSize(int(os.Stdin.Fd()))
 	if err != nil {
 		return fmt.Errorf("getting size: %w", err)
@@ -220,45 +483,76 @@ func shellAction(session, host string) error {
 		}
 	}()
 
-	res, err := client.RequestResponse(&RequestShell{RequestBase{host}, session, w, h})
+	res, err := client.RequestResponse(&RequestShell{RequestBase{host}, session, w, h, mode})
 	if err != nil {
 		return err
 	}
+	if err := responseError(res.Error()); err != nil {
+		return err
+	}
 	return res.Do(client, host)
 }
 
 func killAction() error {
 	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	host, group, session, err := getFocusedSession(&tree)
 	if err != nil {
 		return err
 	}
-	con, err := getFocusedCon(&tree)
+
+	client, err := newClient()
 	if err != nil {
 		return err
 	}
-	host, group, session, err := deserializeHostGroupSessFromCon(con)
+	defer client.Close()
+	res, err := client.RequestResponse(&RequestKill{RequestBase{host}, group, session})
 	if err != nil {
 		return err
 	}
+	if err := responseError(res.Error()); err != nil {
+		return err
+	}
+	log.Println("Killed session", serializeGroupSess(group, session))
+	log.Println(res)
+	notifySuccess("Killed session", serializeHostGroupSess(host, group, session))
+	return nil
+}
 
+func cloneAction(group, host, dstHost string) error {
 	client, err := newClient()
 	if err != nil {
 		return err
 	}
 	defer client.Close()
-	res, err := client.RequestResponse(&RequestKill{RequestBase{host}, group, session})
+	// Create client
+
+	res, err := client.RequestResponse(&RequestDescribe{RequestBase{host}, group})
 	if err != nil {
 		return err
 	}
-	errCode, errMsg := res.Error()
-	if errCode != ErrOk {
-		switch errCode {
-		default:
-			return fmt.Errorf("%s", errMsg)
-		}
+	if err := responseError(res.Error()); err != nil {
+		return fmt.Errorf("%s: %w", host, err)
+	}
+	windows := res.(*ResponseDescribe).Windows
+	// Describe the sessions of the group on the source host
+
+	res, err = client.RequestResponse(&RequestRecreate{RequestBase{dstHost}, group, windows})
+	if err != nil {
+		return err
+	}
+	if err := responseError(res.Error()); err != nil {
+		return fmt.Errorf("%s: %w", dstHost, err)
+	}
+	log.Printf("Cloned %s from %s to %s", group, host, dstHost)
+	// Recreate them on the target host
+
+	err = copyLayoutToHost(group, host, dstHost)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("copying saved layout: %w", err)
 	}
-	log.Println("Killed session", serializeGroupSess(group, session))
-	log.Println(res)
 	return nil
 }
 
@@ -288,100 +582,14 @@ func setUpBasics() error {
 	return nil
 }
 
-func parseFlags() {
-	flag.Parse()
-	if *createCmd != "" || *resumeCmd != "" || *listCmd || *shellCmd {
-		if *hostFlag == "" {
-			fmt.Println("You must specify the target host")
-		}
-	}
-
-	modsCount := 0
-	if *createCmd != "" {
-		modsCount++
-	}
-	if *addCmd {
-		modsCount++
-	}
-	if *detachCmd {
-		modsCount++
-	}
-	if *resumeCmd != "" {
-		modsCount++
-	}
-	if *shellCmd {
-		modsCount++
-	}
-	if *listCmd {
-		modsCount++
-	}
-	if *killCmd {
-		modsCount++
-	}
-	if *serverCmd {
-		modsCount++
-	}
-	if modsCount != 1 {
-		fmt.Println("You must specify one mode among 'new', 'add', 'detach', 'resume', 'kill', 'shell' and 'server'")
-	}
-	// Ensure only one mode is selected
-}
-
 func main() {
 	if err := setUpBasics(); err != nil {
 		log.Fatal("Error performing initial setup: ", err)
 	}
 
-	parseFlags()
-	pref = getUserPreferences()
-
-	if *createCmd != "" {
-		if err := createAction(*createCmd, *hostFlag); err != nil {
-			fmt.Printf("Error creating group: %s\n", err)
-		}
-	}
-	if *addCmd {
-		if err := addAction(); err != nil {
-			log.Fatal("Error adding window: ", err)
-		}
-	}
-	if *detachCmd {
-		if err := detachAction(); err != nil {
-			log.Fatal(fmt.Sprintf("Error detaching group: %s", err))
-		}
-	}
-	if *resumeCmd != "" {
-		if pref.Terminal.Bin == "" || pref.Terminal.NameFlag == "" {
-			fmt.Println("You must specify 'terminal.bin' and 'terminal.nameFlag' options")
-		}
-		if err := resumeAction(*resumeCmd, *hostFlag); err != nil {
-			fmt.Printf("Error resuming group: %s\n", err)
-		}
-	}
-	if *shellCmd {
-		if *sessionFlag == "" {
-			log.Fatal(fmt.Errorf("You must specify the target session"))
-		}
-		err := shellAction(*sessionFlag, *hostFlag)
-		if err != nil {
-			log.Fatal(fmt.Sprintf("Error starting shell for %s: %s", *sessionFlag, err))
-		}
-	}
-	if *listCmd {
-		err := listAction(*hostFlag)
-		if err != nil {
-			errMsg := fmt.Sprintf("Error listing group: %s", err)
-			log.Fatal(fmt.Errorf(errMsg))
-		}
-	}
-	if *killCmd {
-		if err := killAction(); err != nil {
-			log.Fatal(fmt.Errorf("Error killing session: %w", err))
-		}
-	}
-	if *serverCmd {
-		if err := serverAction(); err != nil {
-			log.Fatal("Error spawning server: ", err)
-		}
+	if err := runCommand(os.Args[1:]); err != nil {
+		log.Println(err)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", I3TMUX, err)
+		os.Exit(exitCodeOf(err))
 	}
 }
@@ -142,12 +142,24 @@ func checkScreen(t *testing.T, e *Environment) {
 	}
 }
 
+func checkExitCode(t *testing.T, err error, expected int) {
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		panic(err)
+	}
+	if code != expected {
+		t.Errorf("expected exit code %d, received %d", expected, code)
+	}
+}
+
 func TestNoGroups(t *testing.T) {
 	// t.Parallel()
 	e := newEnvironment()
 	defer e.Close()
 
-	out := e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-list")
+	out := e.RunSuccess(I3TMUX, "list", "-host", SSH_HOSTNAME, "-format", "plain")
 	checkOutput(t, out, e)
 }
 
@@ -156,8 +168,8 @@ func TestCreateGroup(t *testing.T) {
 	e := newEnvironment()
 	defer e.Close()
 
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-create", "foo")
-	out := e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-list")
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	out := e.RunSuccess(I3TMUX, "list", "-host", SSH_HOSTNAME, "-format", "plain")
 	checkOutput(t, out, e)
 }
 
@@ -167,8 +179,8 @@ func TestResumeGroupWithSingleSession(t *testing.T) {
 	defer e.Close()
 
 	e.StartSuccess("i3")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-create", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-resume", "foo")
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "resume", "-host", SSH_HOSTNAME, "foo")
 	out := e.RunSuccess("i3-save-tree")
 	checkOutput(t, out, e)
 }
@@ -179,9 +191,9 @@ func TestAddSessionToGroup(t *testing.T) {
 	defer e.Close()
 
 	e.StartSuccess("i3")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-create", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-resume", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-add")
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "resume", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "add")
 	out := e.RunSuccess("i3-save-tree")
 	checkOutput(t, out, e)
 }
@@ -192,10 +204,10 @@ func TestKillSessionOfGroup(t *testing.T) {
 	defer e.Close()
 
 	e.StartSuccess("i3")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-create", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-resume", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-add")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-kill")
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "resume", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "add")
+	e.RunSuccess(I3TMUX, "kill")
 	out := e.RunSuccess("i3-save-tree")
 	checkOutput(t, out, e)
 }
@@ -206,11 +218,42 @@ func TestDetachResumeGroup(t *testing.T) {
 	defer e.Close()
 
 	e.StartSuccess("i3")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-create", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-resume", "foo")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-add")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-detach")
-	e.RunSuccess(I3TMUX, "-host", SSH_HOSTNAME, "-resume", "foo")
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "resume", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "add")
+	e.RunSuccess(I3TMUX, "detach")
+	e.RunSuccess(I3TMUX, "resume", "-host", SSH_HOSTNAME, "foo")
 	out := e.RunSuccess("i3-save-tree")
 	checkOutput(t, out, e)
 }
+
+func TestListMultipleGroups(t *testing.T) {
+	// t.Parallel()
+	e := newEnvironment()
+	defer e.Close()
+
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "bar")
+	out := e.RunSuccess(I3TMUX, "list", "-host", SSH_HOSTNAME, "-format", "plain")
+	checkOutput(t, out, e)
+}
+
+func TestCreateExistingGroup(t *testing.T) {
+	// t.Parallel()
+	e := newEnvironment()
+	defer e.Close()
+
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	_, err := e.Run(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	checkExitCode(t, err, ExitAlreadyExists)
+}
+
+func TestResumeMissingGroup(t *testing.T) {
+	// t.Parallel()
+	e := newEnvironment()
+	defer e.Close()
+
+	e.RunSuccess(I3TMUX, "create", "-host", SSH_HOSTNAME, "foo")
+	_, err := e.Run(I3TMUX, "resume", "-host", SSH_HOSTNAME, "bar")
+	checkExitCode(t, err, ExitNotFound)
+}
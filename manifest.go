@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	GROUP_MANIFEST_FILE = "groups.yaml"
+)
+
+// GroupManifest maps a group to the hosts its sessions live on.
+// Groups listed here are handled as a single group spanning all
+// of their hosts, e.g.:
+//
+//	deploy:
+//	  - frontend
+//	  - db
+type GroupManifest map[string][]string
+
+func getGroupManifest() (GroupManifest, error) {
+	manifest := make(GroupManifest)
+	f, err := os.ReadFile(path.Join(CONF_DIR, GROUP_MANIFEST_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, fmt.Errorf("opening group manifest: %w", err)
+	}
+	if err := yaml.Unmarshal(f, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing group manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Groups returns the names of the groups in the manifest, sorted
+func (m GroupManifest) Groups() []string {
+	groups := make([]string, 0, len(m))
+	for g := range m {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// hostsOfGroup returns the hosts group lives on: host if given,
+// otherwise the ones listed for group in the manifest
+func hostsOfGroup(group, host string) ([]string, error) {
+	if host != "" {
+		return []string{host}, nil
+	}
+	manifest, err := getGroupManifest()
+	if err != nil {
+		return nil, err
+	}
+	hosts, ok := manifest[group]
+	if !ok || len(hosts) == 0 {
+		return nil, usageErrorf("no host specified and %s not in %s", group, GROUP_MANIFEST_FILE)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	NOTIFY_NONE   = "none"
+	NOTIFY_ERRORS = "errors"
+	NOTIFY_ALL    = "all"
+
+	notificationsDest = "org.freedesktop.Notifications"
+	notificationsPath = "/org/freedesktop/Notifications"
+	notifyMethod      = notificationsDest + ".Notify"
+)
+
+// Urgency levels of the desktop notifications specification
+const (
+	urgencyLow      = byte(0)
+	urgencyNormal   = byte(1)
+	urgencyCritical = byte(2)
+)
+
+// notifyDBus sends a notification to the notification server
+// on the session bus
+func notifyDBus(urgency byte, summary, body string) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("connecting to session bus: %w", err)
+	}
+	obj := conn.Object(notificationsDest, notificationsPath)
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgency)}
+	call := obj.Call(notifyMethod, 0,
+		I3TMUX,     // app_name
+		uint32(0),  // replaces_id
+		"",         // app_icon
+		summary,    // summary
+		body,       // body
+		[]string{}, // actions
+		hints,      // hints
+		int32(-1))  // expire_timeout
+	return call.Err
+}
+
+// notifySend sends a notification through notify-send
+func notifySend(urgency byte, summary, body string) error {
+	urgencies := map[byte]string{
+		urgencyLow:      "low",
+		urgencyNormal:   "normal",
+		urgencyCritical: "critical",
+	}
+	cmd := exec.Command("notify-send", "-a", I3TMUX, "-u", urgencies[urgency], summary, body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, out)
+	}
+	return nil
+}
+
+// notify shows a desktop notification over D-Bus, falling back
+// to notify-send. Failures are only logged.
+func notify(urgency byte, summary, body string) {
+	err := notifyDBus(urgency, summary, body)
+	if err == nil {
+		return
+	}
+	log.Println("Error notifying over D-Bus, falling back to notify-send:", err)
+	if err := notifySend(urgency, summary, body); err != nil {
+		log.Println("Error notifying with notify-send:", err)
+	}
+}
+
+func notifyError(command string, err error) {
+	if pref.Notify == NOTIFY_NONE {
+		return
+	}
+	notify(urgencyCritical, fmt.Sprintf("%s %s failed", I3TMUX, command), err.Error())
+}
+
+func notifyWarning(summary, body string) {
+	if pref.Notify == NOTIFY_NONE {
+		return
+	}
+	notify(urgencyNormal, summary, body)
+}
+
+func notifySuccess(summary, body string) {
+	if pref.Notify != NOTIFY_ALL {
+		return
+	}
+	notify(urgencyLow, summary, body)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type notification struct {
+	summary, body string
+	urgency       byte
+}
+
+// fakeNotifications records the notifications it is sent
+type fakeNotifications struct {
+	received chan notification
+}
+
+func (f *fakeNotifications) Notify(app string, id uint32, icon, summary, body string,
+	actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	urgency, _ := hints["urgency"].Value().(byte)
+	f.received <- notification{summary, body, urgency}
+	return 1, nil
+}
+
+// startSessionBus starts a private session bus along with a fake
+// notification server on it, and returns the notifications it receives
+func startSessionBus(t *testing.T) chan notification {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, ok := os.LookupEnv("DBUS_SESSION_BUS_ADDRESS")
+	os.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(addr))
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("DBUS_SESSION_BUS_ADDRESS", saved)
+		} else {
+			os.Unsetenv("DBUS_SESSION_BUS_ADDRESS")
+		}
+	})
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	f := &fakeNotifications{make(chan notification, 16)}
+	if err := conn.Export(f, notificationsPath, notificationsDest); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(notificationsDest, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("requesting %s: %v", notificationsDest, err)
+	}
+	return f.received
+}
+
+func receive(t *testing.T, received chan notification) notification {
+	select {
+	case n := <-received:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+		return notification{}
+	}
+}
+
+// TestNotify runs on a single bus, since the session bus
+// connection is shared by the whole process
+func TestNotify(t *testing.T) {
+	received := startSessionBus(t)
+
+	t.Run("dbus", func(t *testing.T) {
+		if err := notifyDBus(urgencyCritical, "summary", "body"); err != nil {
+			t.Fatal(err)
+		}
+		expected := notification{"summary", "body", urgencyCritical}
+		if n := receive(t, received); n != expected {
+			t.Errorf("expected %+v, received %+v", expected, n)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		defer func(saved Pref) { pref = saved }(pref)
+		sends := []struct {
+			name    string
+			send    func()
+			summary string
+			urgency byte
+		}{
+			{"error", func() { notifyError("add", errors.New("body")) }, I3TMUX + " add failed", urgencyCritical},
+			{"warning", func() { notifyWarning("warning", "body") }, "warning", urgencyNormal},
+			{"success", func() { notifySuccess("success", "body") }, "success", urgencyLow},
+		}
+		tests := []struct {
+			notify string
+			sent   []bool // error, warning, success
+		}{
+			{NOTIFY_NONE, []bool{false, false, false}},
+			{NOTIFY_ERRORS, []bool{true, true, false}},
+			{NOTIFY_ALL, []bool{true, true, true}},
+		}
+		for _, test := range tests {
+			pref.Notify = test.notify
+			for i, s := range sends {
+				s.send()
+				// Whatever comes before the end mark was sent by s
+				notify(urgencyLow, "end", "")
+				n := receive(t, received)
+				if !test.sent[i] {
+					if n.summary != "end" {
+						t.Errorf("%s %s: unexpected %+v", test.notify, s.name, n)
+						receive(t, received)
+					}
+					continue
+				}
+				expected := notification{s.summary, "body", s.urgency}
+				if n != expected {
+					t.Errorf("%s %s: expected %+v, received %+v", test.notify, s.name, expected, n)
+				}
+				if n.summary != "end" {
+					receive(t, received)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"go.i3wm.org/i3/v4"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// Policies for sessions whose window is closed through i3
+const (
+	ONCLOSE_KEEP = "keep"
+	ONCLOSE_KILL = "kill"
+	ONCLOSE_ASK  = "ask"
+)
+
+const (
+	// Marks of the windows closed by i3tmux itself, e.g. on detach
+	CLOSE_MARK_PREFIX = "_i3tmux_close"
+	// Time waited for the shell of a window closed to end, and then for
+	// its tmux client to leave the session
+	ONCLOSE_TIMEOUT = 10 * time.Second
+	ONCLOSE_POLL    = 500 * time.Millisecond
+	// Time shells ending are matched to windows closing, either way
+	SHELL_END_TTL = ONCLOSE_TIMEOUT
+)
+
+// Menus running in a terminal, which the server has none of
+var TERMINAL_MENUS = map[string]bool{
+	"fzf":  true,
+	"sk":   true,
+	"peco": true,
+}
+
+func closeMark(id i3.NodeID) string {
+	return fmt.Sprintf("%s_%d", CLOSE_MARK_PREFIX, id)
+}
+
+// closedByI3tmux tells whether con was closed by i3tmux itself
+func closedByI3tmux(con *i3.Node) bool {
+	for _, mark := range con.Marks {
+		if strings.HasPrefix(mark, CLOSE_MARK_PREFIX) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWindowClose applies the policy preferred to the session of con,
+// if it is the window of a session closed through i3
+func handleWindowClose(con *i3.Node) {
+	if pref.OnClose == ONCLOSE_KEEP {
+		return
+	}
+	host, group, session, err := deserializeHostGroupSessFromCon(con)
+	if err != nil {
+		return
+	}
+	if closedByI3tmux(con) {
+		// Consume the end of its shell, not to match it to another window
+		go waitShellEnd(serializeHostGroupSess(host, group, session), ONCLOSE_TIMEOUT)
+		return
+	}
+	go func() {
+		if err := applyClosePolicy(host, group, session); err != nil {
+			log.Printf("Error applying %s policy to %s: %s", pref.OnClose,
+				serializeHostGroupSess(host, group, session), err)
+		}
+	}()
+}
+
+// applyClosePolicy kills the session, or asks whether to, if the shell
+// of its window ended because the window was closed, unless the session
+// has gone already or is still attached elsewhere
+func applyClosePolicy(host, group, session string) error {
+	instance := serializeHostGroupSess(host, group, session)
+	end, ok := waitShellEnd(instance, ONCLOSE_TIMEOUT)
+	if !ok {
+		log.Println("No shell of", instance, "ended, keeping it")
+		return nil
+	}
+	if !end.ClientGone {
+		// Detached from tmux, exited or lost the connection to the host
+		return nil
+	}
+	if getOpenSessions()[instance] {
+		// Another window is still attached to it
+		return nil
+	}
+	if pref.OnClose == ONCLOSE_ASK && TERMINAL_MENUS[path.Base(menuCommand()[0])] {
+		return fmt.Errorf("menu %s needs a terminal, keeping %s", menuCommand()[0], instance)
+	}
+	sshClient, err := getSSHClient(host)
+	if err != nil {
+		return err
+	}
+	found, err := waitDetached(sshClient, group, session, end.At.Add(ONCLOSE_TIMEOUT))
+	if err != nil || !found {
+		// Killed with i3tmux kill, exited or attached elsewhere
+		return err
+	}
+
+	if pref.OnClose == ONCLOSE_ASK {
+		killEntry := "kill " + instance
+		choice, err := runMenu([]string{"keep " + instance, killEntry})
+		if err != nil {
+			return err
+		}
+		if choice != killEntry {
+			return nil
+		}
+	}
+	if stderr, err := killSession(group, session, sshClient); err != nil {
+		return fmt.Errorf("%w: %s", err, stderr)
+	}
+	log.Println("Killed session", instance, "closed through i3")
+	return nil
+}
+
+// waitDetached waits until no client is attached to session of group,
+// but for those of this server, at most until deadline, and tells
+// whether it was found so
+func waitDetached(sshClient *SSHClient, group, session string, deadline time.Time) (bool, error) {
+	instance := serializeHostGroupSess(sshClient.host, group, session)
+	for {
+		infos, errCode, errMsg := fetchSessionInfos(sshClient)
+		if errCode != ErrOk {
+			return false, responseError(errCode, errMsg)
+		}
+		found, attached := false, 0
+		for _, info := range infos {
+			if info.Group == group && info.Session == session {
+				found, attached = true, info.Attached-localClientsOf(instance)
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+		if attached <= 0 {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			// The tmux client of the window closed may still be leaving
+			log.Println("Keeping", instance, "attached elsewhere")
+			return false, nil
+		}
+		time.Sleep(ONCLOSE_POLL)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+var (
+	MENU_DEFAULT = []string{"dmenu"}
+)
+
+// pickEntries returns the entries offered by the picker:
+// GROUP@HOST for the groups found on the listed hosts and
+// GROUP for those in the group manifest
+func pickEntries() ([]string, error) {
+	hosts, err := getListedHosts()
+	if err != nil {
+		return nil, err
+	}
+	infos, _ := fetchInfosOfHosts(hosts)
+	// Unreachable hosts just offer no group
+
+	seen := make(map[string]bool)
+	var entries []string
+	for _, info := range infos {
+		entry := info.Group + HOST_DELIM + info.Host
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	manifest, err := getGroupManifest()
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, manifest.Groups()...)
+	sort.Strings(entries)
+	return entries, nil
+}
+
+// menuCommand returns the menu program preferred, along with its arguments
+func menuCommand() []string {
+	if len(pref.Menu) == 0 {
+		return MENU_DEFAULT
+	}
+	return pref.Menu
+}
+
+// runMenu pipes entries to the menu program and returns the choice,
+// empty if the menu was dismissed
+func runMenu(entries []string) (string, error) {
+	menu := menuCommand()
+	cmd := exec.Command(menu[0], menu[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(entries, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stdout.Len() == 0 {
+			// Menu dismissed
+			return "", nil
+		}
+		return "", fmt.Errorf("running menu %s: %w", menu[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// splitGroupHost splits an entry of the menu in group and host,
+// empty for groups of the manifest
+func splitGroupHost(entry string) (string, string) {
+	if i := strings.LastIndex(entry, HOST_DELIM); i >= 0 {
+		return entry[:i], entry[i+len(HOST_DELIM):]
+	}
+	return entry, ""
+}
+
+// pickGroup lets the user pick a group through the menu, and returns it
+// along with the choice, empty if the menu was dismissed. Entries not
+// offered by the menu are created first.
+func pickGroup() (group, host, choice string, err error) {
+	entries, err := pickEntries()
+	if err != nil {
+		return "", "", "", err
+	}
+	choice, err = runMenu(entries)
+	if err != nil || choice == "" {
+		return "", "", "", err
+	}
+
+	group, host = splitGroupHost(choice)
+	exists := false
+	for _, e := range entries {
+		if e == choice {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		if err := createAction(group, host, "", ""); err != nil {
+			return "", "", "", fmt.Errorf("creating %s: %w", choice, err)
+		}
+	}
+	return group, host, choice, nil
+}
+
+// pickAction lets the user pick a group through the menu and resumes it
+func pickAction() error {
+	group, host, choice, err := pickGroup()
+	if err != nil || choice == "" {
+		return err
+	}
+	if err := resumeAction(group, host, ResumeOptions{}); err != nil {
+		return err
+	}
+	notifySuccess("Resumed group", choice)
+	return nil
+}
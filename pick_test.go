@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSplitGroupHost(t *testing.T) {
+	tests := []struct {
+		entry, group, host string
+	}{
+		{"g@h", "g", "h"},
+		{"g", "g", ""},
+		{"g@user@h", "g@user", "h"},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		group, host := splitGroupHost(test.entry)
+		if group != test.group || host != test.host {
+			t.Errorf("%q split in %q %q, expected %q %q", test.entry, group, host, test.group, test.host)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.i3wm.org/i3/v4"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"time"
+)
+
+const (
+	// Marks placeholders until their container is found, then dropped
+	PENDING_MARK_PREFIX = "_i3tmux_pending"
+	// Time errors are shown in place of the windows expected
+	ERROR_PLACEHOLDER_TIMEOUT = 5 * time.Second
+)
+
+// Placeholder is a container shown in the focused workspace while
+// the window expected there is in flight
+type Placeholder struct {
+	id     i3.NodeID
+	closed bool
+}
+
+// openPlaceholder appends a placeholder titled name to the focused
+// workspace, swallowing the window whose instance matches instanceRe,
+// or none if instanceRe is empty
+func openPlaceholder(name, instanceRe string) (*Placeholder, error) {
+	mark := fmt.Sprintf("%s_%d_%d", PENDING_MARK_PREFIX, os.Getpid(), time.Now().UnixNano())
+	if instanceRe == "" {
+		instanceRe = "^" + mark + "$"
+	}
+	layout := map[string]interface{}{
+		"type":     i3.Con,
+		"name":     name,
+		"marks":    []string{mark},
+		"swallows": []map[string]string{{"instance": instanceRe}},
+	}
+	j, err := json.Marshal(layout)
+	if err != nil {
+		return nil, err
+	}
+	layoutPath := path.Join(RUNTIME_DIR, mark+".json")
+	if err := ioutil.WriteFile(layoutPath, j, 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(layoutPath)
+	if _, err := i3.RunCommand(fmt.Sprintf("append_layout %s", layoutPath)); err != nil {
+		return nil, err
+	}
+
+	tree, err := i3.GetTree()
+	if err != nil {
+		return nil, err
+	}
+	con := tree.Root.FindChild(func(n *i3.Node) bool {
+		for _, m := range n.Marks {
+			if m == mark {
+				return true
+			}
+		}
+		return false
+	})
+	if con == nil {
+		return nil, fmt.Errorf("placeholder %s not found", mark)
+	}
+	if _, err := i3.RunCommand(fmt.Sprintf("[con_id=%d] unmark %s", con.ID, i3Quote(mark))); err != nil {
+		return nil, err
+	}
+	// Windows filling it would keep the mark, and layouts record marks
+	return &Placeholder{id: con.ID}, nil
+}
+
+// pendingPlaceholder opens a placeholder as openPlaceholder does, but
+// returns nil on errors, e.g. without i3, to just go without
+func pendingPlaceholder(name, instanceRe string) *Placeholder {
+	p, err := openPlaceholder(name, instanceRe)
+	if err != nil {
+		log.Println("Error opening placeholder", err)
+		return nil
+	}
+	return p
+}
+
+// sessionsInstanceRe matches the instances of the sessions of group on host
+func sessionsInstanceRe(group, host string) string {
+	return "^" + regexp.QuoteMeta(group+GROUP_SESS_DELIM) + `session\d+` +
+		regexp.QuoteMeta(HOST_DELIM+host) + "$"
+}
+
+// Close closes the placeholder, unless it is nil, closed already or
+// filled by the window it was waiting for
+func (p *Placeholder) Close() error {
+	if p == nil || p.closed {
+		return nil
+	}
+	tree, err := i3.GetTree()
+	if err != nil {
+		return err
+	}
+	con := tree.Root.FindChild(func(n *i3.Node) bool {
+		return n.ID == p.id
+	})
+	if con != nil && con.Window == 0 {
+		if _, err := i3.RunCommand(fmt.Sprintf("[con_id=%d] kill", p.id)); err != nil {
+			return err
+		}
+	}
+	p.closed = true
+	return nil
+}
+
+// Fail replaces the placeholder, unless it is nil, with one showing err
+// for a while. i3 closes the latter, so that errors are not held back.
+func (p *Placeholder) Fail(err error) {
+	if p == nil {
+		return
+	}
+	if cerr := p.Close(); cerr != nil {
+		log.Println("Error closing placeholder", cerr)
+		return
+	}
+	e, perr := openPlaceholder(fmt.Sprintf("%s: %s", I3TMUX, err), "")
+	if perr != nil {
+		log.Println("Error opening placeholder", perr)
+		return
+	}
+	closeCmd := fmt.Sprintf("sleep %d; i3-msg '[con_id=%d] kill' >/dev/null",
+		int(ERROR_PLACEHOLDER_TIMEOUT/time.Second), e.id)
+	if _, cerr := i3.RunCommand("exec --no-startup-id " + i3Quote(closeCmd)); cerr != nil {
+		log.Println("Error closing placeholder", cerr)
+	}
+}
@@ -40,11 +40,11 @@ type RequestList struct {
 }
 
 func (r *RequestList) Do(sshClient *SSHClient, client *Client) Response {
-	sessionsPerGroup, errCode, errMsg := fetchSessionsPerGroup(sshClient)
+	infos, errCode, errMsg := fetchSessionInfos(sshClient)
 	if errCode != ErrOk {
 		return newErrorResponse(errCode, errMsg)
 	}
-	return &ResponseList{Sessions: sessionsPerGroup}
+	return &ResponseList{Infos: infos}
 }
 
 var _ Request = (*RequestCreate)(nil)
@@ -52,6 +52,8 @@ var _ Request = (*RequestCreate)(nil)
 type RequestCreate struct {
 	RequestBase
 	Group string
+	Cwd   string
+	Cmd   string
 }
 
 func (r *RequestCreate) Do(sshClient *SSHClient, client *Client) Response {
@@ -69,7 +71,7 @@ func (r *RequestCreate) Do(sshClient *SSHClient, client *Client) Response {
 	if _, ok := sessionsPerGroup[r.Group]; ok {
 		return newErrorResponse(GroupAlreadyExistsError, errMsg)
 	}
-	_, stderr, err := createSession(r.Group, "session0", sshClient)
+	_, stderr, err := createSession(r.Group, "session0", r.Cwd, r.Cmd, sshClient)
 	if err != nil {
 		return newErrorResponse(UnknownError, fmt.Sprintf("%s: %s", err, stderr))
 	}
@@ -81,6 +83,9 @@ var _ Request = (*RequestAdd)(nil)
 type RequestAdd struct {
 	RequestBase
 	Group string
+	Sess  string // session the new one is added next to
+	Cwd   string
+	Cmd   string
 }
 
 func (r *RequestAdd) Do(sshClient *SSHClient, client *Client) Response {
@@ -93,8 +98,17 @@ func (r *RequestAdd) Do(sshClient *SSHClient, client *Client) Response {
 		return newErrorResponse(UnknownError, err.Error())
 	}
 	nextSess := fmt.Sprintf("session%d", nextSessIdx)
+	cwd := r.Cwd
+	if cwd == "" && r.Sess != "" {
+		cwd, err = fetchPaneCurrentPath(r.Group, r.Sess, sshClient)
+		if err != nil {
+			// Fall back to tmux's default start directory
+			log.Println("Error fetching current path of", r.Sess, err)
+		}
+	}
+	// Start in the directory of the focused session unless told otherwise
 	log.Println("Adding session to group", r.Group, nextSess)
-	_, stderr, err := createSession(r.Group, nextSess, sshClient)
+	_, stderr, err := createSession(r.Group, nextSess, cwd, r.Cmd, sshClient)
 	if err != nil {
 		return newErrorResponse(UnknownError, fmt.Sprintf("%s: %s", err, stderr))
 	}
@@ -106,18 +120,125 @@ var _ Request = (*RequestResume)(nil)
 type RequestResume struct {
 	RequestBase
 	Group string
+	Mode  AttachMode
 }
 
 func (r *RequestResume) Do(sshClient *SSHClient, client *Client) Response {
+	infos, errCode, errMsg := fetchSessionInfos(sshClient)
+	if errCode != ErrOk {
+		return newErrorResponse(errCode, errMsg)
+	}
+	sessions := make(Sessions)
+	attached := make(Sessions)
+	attachedHere := make(Sessions)
+	for _, info := range infos {
+		if info.Group != r.Group {
+			continue
+		}
+		sessions[info.Session] = true
+		local := localClientsOf(serializeHostGroupSess(r.Host, info.Group, info.Session))
+		if info.Attached > local {
+			attached[info.Session] = true
+		}
+		if local > 0 {
+			attachedHere[info.Session] = true
+		}
+	}
+	if len(sessions) == 0 {
+		return newErrorResponse(GroupNotFoundError, "")
+	}
+	return &ResponseResume{
+		Group:        r.Group,
+		Sessions:     sessions,
+		Attached:     attached,
+		AttachedHere: attachedHere,
+		Mode:         r.Mode,
+	}
+}
+
+var _ Request = (*RequestDescribe)(nil)
+
+// RequestDescribe retrieves the windows of each session of a group
+type RequestDescribe struct {
+	RequestBase
+	Group string
+}
+
+func (r *RequestDescribe) Do(sshClient *SSHClient, client *Client) Response {
 	sessionsPerGroup, errCode, errMsg := fetchSessionsPerGroup(sshClient)
 	if errCode != ErrOk {
 		return newErrorResponse(errCode, errMsg)
 	}
-	if sessions, ok := sessionsPerGroup[r.Group]; ok {
-		return &ResponseResume{Group: r.Group, Sessions: sessions}
-	} else {
+	sessions, ok := sessionsPerGroup[r.Group]
+	if !ok {
 		return newErrorResponse(GroupNotFoundError, "")
 	}
+	windowsPerSession := make(map[string][]WindowSpec)
+	for s := range sessions {
+		windows, err := fetchWindowSpecs(r.Group, s, sshClient)
+		if err != nil {
+			return newErrorResponse(UnknownError, err.Error())
+		}
+		windowsPerSession[s] = windows
+	}
+	return &ResponseDescribe{Group: r.Group, Windows: windowsPerSession}
+}
+
+var _ Request = (*RequestRecreate)(nil)
+
+// RequestRecreate creates the sessions of a group with the given windows
+type RequestRecreate struct {
+	RequestBase
+	Group   string
+	Windows map[string][]WindowSpec
+}
+
+func (r *RequestRecreate) Do(sshClient *SSHClient, client *Client) Response {
+	sessionsPerGroup, errCode, errMsg := fetchSessionsPerGroup(sshClient)
+	switch errCode {
+	case ErrOk:
+	case TmuxNoSessionsError:
+	default:
+		return newErrorResponse(errCode, errMsg)
+	}
+	if _, ok := sessionsPerGroup[r.Group]; ok {
+		return newErrorResponse(GroupAlreadyExistsError, "")
+	}
+	sessions := make(Sessions)
+	for s := range r.Windows {
+		sessions[s] = true
+	}
+	var created []string
+	for _, s := range sortedSessions(sessions) {
+		created = append(created, s)
+		// The session exists as soon as its first window does
+		if _, stderr, err := recreateSession(r.Group, s, r.Windows[s], sshClient); err != nil {
+			for _, c := range created {
+				// Leave no partial group behind, for the clone to be retried
+				if kstderr, kerr := killSession(r.Group, c, sshClient); kerr != nil && c != s {
+					log.Printf("Error killing %s: %s: %s", serializeGroupSess(r.Group, c), kerr, kstderr)
+				}
+			}
+			return newErrorResponse(UnknownError, fmt.Sprintf("%s: %s", err, stderr))
+		}
+	}
+	return &ResponseBase{}
+}
+
+var _ Request = (*RequestCachedSessions)(nil)
+var _ LocalRequest = (*RequestCachedSessions)(nil)
+
+// RequestCachedSessions retrieves the sessions last seen on a host
+type RequestCachedSessions struct {
+	RequestBase
+}
+
+func (r *RequestCachedSessions) Do(sshClient *SSHClient, client *Client) Response {
+	return r.DoLocal(client)
+}
+
+func (r *RequestCachedSessions) DoLocal(client *Client) Response {
+	return &ResponseCachedSessions{Sessions: cachedSessions(r.Host)}
 }
 
 var _ Request = (*RequestKill)(nil)
@@ -129,14 +250,11 @@ type RequestKill struct {
 }
 
 func (r *RequestKill) Do(sshClient *SSHClient, client *Client) Response {
-	groupSess := serializeGroupSess(r.Group, r.Sess)
-	cmd := fmt.Sprintf("tmux kill-session -t %s", groupSess)
-	_, stderr, err := sshClient.Run(cmd)
+	stderr, err := killSession(r.Group, r.Sess, sshClient)
 	if err != nil {
-		errMsg := fmt.Sprintf("unable to execute remote cmd: %s, %s, %s",
-			cmd,
-			stderr,
-			err)
+		errMsg := fmt.Sprintf("unable to execute remote cmd: %s, %s",
+			err,
+			stderr)
 		return newErrorResponse(UnknownError, errMsg)
 	}
 	return &ResponseKill{}
@@ -148,6 +266,57 @@ type RequestShell struct {
 	RequestBase
 	SessionGroup  string
 	Width, Height int
+	Mode          AttachMode
+}
+
+// AttachMode tells how a shell attaches to a session other clients
+// may be attached to
+type AttachMode int
+
+const (
+	AttachDefault  AttachMode = iota // attach alone, resume skips sessions attached elsewhere
+	AttachSteal                      // detach other clients, even on resume
+	AttachShared                     // share the session with other clients
+	AttachReadOnly                   // share the session without sending input
+)
+
+// ShellArgs returns the flags of the 'shell' command selecting m
+func (m AttachMode) ShellArgs() []string {
+	switch m {
+	case AttachSteal:
+		return []string{"-steal"}
+	case AttachShared:
+		return []string{"-shared"}
+	case AttachReadOnly:
+		return []string{"-read-only"}
+	default:
+		return nil
+	}
+}
+
+// TitleTag returns the tag marking windows attached in mode m,
+// empty if they need none
+func (m AttachMode) TitleTag() string {
+	switch m {
+	case AttachShared:
+		return "shared"
+	case AttachReadOnly:
+		return "read-only"
+	default:
+		return ""
+	}
+}
+
+func (m AttachMode) attachCmd(sessionGroup string) string {
+	switch m {
+	case AttachShared:
+		return fmt.Sprintf("tmux attach-session -t %s", sessionGroup)
+	case AttachReadOnly:
+		return fmt.Sprintf("tmux attach-session -r -t %s", sessionGroup)
+	default:
+		// No window is left sharing the session unmarked
+		return fmt.Sprintf("tmux attach-session -d -t %s", sessionGroup)
+	}
 }
 
 type WindowSize struct {
@@ -202,19 +371,33 @@ func (r *RequestShell) Do(sshClient *SSHClient, client *Client) Response {
 	session.Stdout = stdout
 	session.Stderr = stderr
 
+	clientGone := make(chan struct{})
 	go func() {
 		for {
 			var winSize WindowSize
 			if err := client.dec.Decode(&winSize); err != nil {
+				// Client is gone, do not leave its tmux client attached
+				close(clientGone)
+				session.Close()
 				return
 			}
 			session.WindowChange(winSize.Height, winSize.Width)
 		}
 	}()
-	cmd := fmt.Sprintf("tmux attach-session -d -t %s", r.SessionGroup)
-	if err := session.Run(cmd); err != nil {
+	hostGroupSess := r.SessionGroup + HOST_DELIM + r.Host
+	addLocalClient(hostGroupSess, 1)
+	cmd := r.Mode.attachCmd(r.SessionGroup)
+	err = session.Run(cmd)
+	if err != nil {
 		log.Println(err)
 	}
+	select {
+	case <-clientGone:
+		endLocalClient(hostGroupSess, true)
+	default:
+		// Detached, exited or lost the connection to the host
+		endLocalClient(hostGroupSess, false)
+	}
 	return &ResponseBase{}
 }
 
@@ -224,6 +407,9 @@ func init() {
 	gob.Register(&RequestAdd{})
 	gob.Register(&RequestResume{})
 	gob.Register(&RequestKill{})
+	gob.Register(&RequestDescribe{})
+	gob.Register(&RequestRecreate{})
+	gob.Register(&RequestCachedSessions{})
 	gob.Register(&WindowSize{})
 	gob.Register(&RequestShell{})
 }
@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"go.i3wm.org/i3/v4"
 	"golang.org/x/term"
+	"io/ioutil"
+	"log"
 	"net"
 	"os"
 	"path"
@@ -16,6 +19,7 @@ const (
 	GroupAlreadyExistsError = iota
 	GroupNotFoundError      = iota
 	InvalidGroupNameError   = iota
+	HostUnreachableError    = iota
 	UnknownError            = iota
 )
 
@@ -58,45 +62,171 @@ var _ Response = (*ResponseList)(nil)
 
 type ResponseList struct {
 	ResponseBase
-	Sessions SessionsPerGroup
+	Infos []SessionInfo
 }
 
 func (r *ResponseList) Do(client *Client, host string) error {
-	for g, sessions := range r.Sessions {
-		fmt.Println(g + ":")
-		for s := range sessions {
-			fmt.Printf("- %s\n", s)
-		}
+	for i := range r.Infos {
+		r.Infos[i].Host = host
 	}
-	return nil
+	markOpenSessions(r.Infos)
+	return printSessionInfos(r.Infos, listFormat, false, nil)
 }
 
 var _ Response = (*ResponseResume)(nil)
 
+// ResumeOptions tells how to resume a group
+type ResumeOptions struct {
+	Mode   AttachMode
+	Layout string // name of the saved layout to restore, the latest if empty
+	Here   bool   // resume in the focused workspace rather than the saved ones
+}
+
 type ResponseResume struct {
 	ResponseBase
-	Group    string
-	Sessions Sessions
+	Group        string
+	Sessions     Sessions
+	Attached     Sessions // sessions with clients attached from elsewhere
+	AttachedHere Sessions // sessions with clients of this server attached
+	Mode         AttachMode
+	opts         ResumeOptions // set by the client
 }
 
-func (r *ResponseResume) Do(client *Client, host string) error {
-	resumeLayoutPath := path.Join(DATA_DIR, r.Group+".json")
-	_, err := os.Stat(resumeLayoutPath)
+// appendSavedLayout appends the layout saved for group on host, if any,
+// to the workspaces it was saved from. The layout is first reconciled
+// with the sessions about to be launched, serialized as their instances.
+func appendSavedLayout(group, host string, instances []string, opts ResumeOptions) error {
+	p, err := savedLayoutPath(group, host, opts.Layout)
+	if err != nil {
+		return err
+	}
+	layout, err := readGroupLayout(p)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			// If error is not expected exit
 			return fmt.Errorf("opening saved layout: %s", err)
 		}
-	} else {
+		if opts.Layout != "" && opts.Layout != LAYOUT_LATEST {
+			return withExitCode(ExitNotFound, fmt.Errorf("layout %s not found", opts.Layout))
+		}
+		return nil
+	}
+	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	layout.Reconcile(instances, getOpenWindows(&tree), pref.NewSessions)
+	// None of the saved sessions may be left, and other windows may be open
+
+	here := opts.Here || groupWorkspace(group, host) != ""
+	// Groups with a workspace of their own are resumed there
+	resumeLayoutPath := path.Join(RUNTIME_DIR, group+".resume.json")
+	defer os.Remove(resumeLayoutPath)
+	for _, ws := range layout.Workspaces {
+		if ws.Workspace != "" && !here {
+			if err := focusWorkspace(ws.Workspace, ws.Output); err != nil {
+				return err
+			}
+		}
+		// Layouts saved by older versions go to the focused workspace
+
+		var j []byte
+		for _, u := range append([]map[string]interface{}{ws.Layout}, ws.Floating...) {
+			if u == nil {
+				continue
+			}
+			uj, err := json.Marshal(u)
+			if err != nil {
+				return err
+			}
+			j = append(append(j, uj...), '\n')
+		}
+		// Floating windows follow as top level containers
+
+		if err := ioutil.WriteFile(resumeLayoutPath, j, 0644); err != nil {
+			return err
+		}
 		_, err = i3.RunCommand(fmt.Sprintf("append_layout %s", resumeLayoutPath))
 		if err != nil {
-			return fmt.Errorf("appending i3 layout: %w", err)
+			return withExitCode(ExitI3, fmt.Errorf("appending i3 layout: %w", err))
+		}
+	}
+	return nil
+}
+
+func (r *ResponseResume) Do(client *Client, host string) error {
+	if !r.opts.Here {
+		if _, err := focusGroupWorkspace(r.Group, layoutHostOf(r.Group, host)); err != nil {
+			return err
+		}
+	}
+	open := getOpenSessions()
+	toLaunch := r.SessionsToLaunch(host, open)
+	if !r.IsOpen(host, open) {
+		err := appendSavedLayout(r.Group, layoutHostOf(r.Group, host), r.Instances(host, toLaunch), r.opts)
+		if err != nil {
+			return err
 		}
 	}
-	// Try to load a layout for the target sessions group
+	// Try to load a layout for the target sessions group, unless
+	// some of its windows are already there
 
+	return r.LaunchTerms(host, toLaunch)
+}
+
+// IsOpen tells whether some of the sessions have a window in the local i3 tree
+func (r *ResponseResume) IsOpen(host string, open map[string]bool) bool {
 	for s := range r.Sessions {
-		err := launchTermForSession(r.Group, s, host)
+		if open[serializeHostGroupSess(host, r.Group, s)] {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionsToLaunch returns the sessions not open locally along with the
+// mode to attach them in. Sessions attached elsewhere are skipped, unless
+// they are to be stolen or shared.
+func (r *ResponseResume) SessionsToLaunch(host string, open map[string]bool) map[string]AttachMode {
+	toLaunch := make(map[string]AttachMode)
+	for _, s := range sortedSessions(r.Sessions) {
+		hostGroupSess := serializeHostGroupSess(host, r.Group, s)
+		if open[hostGroupSess] {
+			log.Println("Skipping", hostGroupSess, "already open")
+			continue
+		}
+		mode := r.Mode
+		switch {
+		case mode == AttachShared || mode == AttachReadOnly:
+		case r.Attached[s]:
+			if mode != AttachSteal {
+				log.Println("Skipping", hostGroupSess, "attached elsewhere")
+				notifyWarning("Skipped "+hostGroupSess,
+					"Attached elsewhere, resume with -steal to detach it or -shared to share it")
+				continue
+			}
+		case r.AttachedHere[s]:
+			// Clients left over by windows no longer open
+			mode = AttachSteal
+		}
+		toLaunch[s] = mode
+	}
+	return toLaunch
+}
+
+// Instances returns the instances of the windows of sessions
+func (r *ResponseResume) Instances(host string, sessions map[string]AttachMode) []string {
+	var instances []string
+	for s := range sessions {
+		instances = append(instances, serializeHostGroupSess(host, r.Group, s))
+	}
+	return instances
+}
+
+// LaunchTerms launches a terminal for each of the sessions
+func (r *ResponseResume) LaunchTerms(host string, sessions map[string]AttachMode) error {
+	for s, mode := range sessions {
+		err := launchTermForSession(r.Group, s, host, mode.ShellArgs()...)
 		if err != nil {
 			return fmt.Errorf("launching term for %s: %w", s, err)
 		}
@@ -113,6 +243,11 @@ type ResponseAdd struct {
 }
 
 func (r *ResponseAdd) Do(client *Client, host string) error {
+	if _, err := focusGroupWorkspace(r.Group, layoutHostOf(r.Group, host)); err != nil {
+		return err
+	}
+	// Open the window in the workspace of the group, if any
+
 	err := launchTermForSession(r.Group, r.Session, host)
 	if err != nil {
 		return fmt.Errorf("launching term for %s: %w", r.Session, err)
@@ -120,6 +255,21 @@ func (r *ResponseAdd) Do(client *Client, host string) error {
 	return nil
 }
 
+var _ Response = (*ResponseDescribe)(nil)
+
+type ResponseDescribe struct {
+	ResponseBase
+	Group   string
+	Windows map[string][]WindowSpec
+}
+
+var _ Response = (*ResponseCachedSessions)(nil)
+
+type ResponseCachedSessions struct {
+	ResponseBase
+	Sessions SessionsPerGroup
+}
+
 var _ Response = (*ResponseKill)(nil)
 
 type ResponseKill struct{ ResponseBase }
@@ -164,5 +314,7 @@ func init() {
 	gob.Register(&ResponseList{})
 	gob.Register(&ResponseResume{})
 	gob.Register(&ResponseKill{})
+	gob.Register(&ResponseDescribe{})
+	gob.Register(&ResponseCachedSessions{})
 	gob.Register(&ResponseShell{})
 }
@@ -7,7 +7,9 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type Server struct{}
@@ -32,6 +34,8 @@ func (s *Server) Run() error {
 	// Check if server socket exists
 	log.Println("Starting server ...")
 
+	go watchI3Events()
+
 	termSignals := make(chan os.Signal, 1)
 	signal.Notify(termSignals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
@@ -65,9 +69,162 @@ func (s *Server) Stop() {
 }
 
 var (
-	sshClients = make(map[string]*SSHClient)
+	sshClients   = make(map[string]*SSHClient)
+	sshDialMus   = make(map[string]*sync.Mutex)
+	sshClientsMu sync.Mutex
+)
+
+// getSSHClient returns the pooled connection to host, dialling it if needed.
+// Hosts are dialled concurrently, while dials to the same host are serialized.
+func getSSHClient(host string) (*SSHClient, error) {
+	sshClientsMu.Lock()
+	sshClient, ok := sshClients[host]
+	dialMu, dialing := sshDialMus[host]
+	if !dialing {
+		dialMu = &sync.Mutex{}
+		sshDialMus[host] = dialMu
+	}
+	sshClientsMu.Unlock()
+	if ok {
+		return sshClient, nil
+	}
+
+	dialMu.Lock()
+	defer dialMu.Unlock()
+	sshClientsMu.Lock()
+	sshClient, ok = sshClients[host]
+	sshClientsMu.Unlock()
+	if ok {
+		// Dialled while waiting
+		return sshClient, nil
+	}
+	log.Println("Creating client for", host)
+	sshClient, err := newSSHClient(host)
+	if err != nil {
+		return nil, err
+	}
+	sshClientsMu.Lock()
+	sshClients[host] = sshClient
+	sshClientsMu.Unlock()
+	go func() {
+		sshClient.Wait()
+		sshClientsMu.Lock()
+		delete(sshClients, host)
+		sshClientsMu.Unlock()
+	}()
+	return sshClient, nil
+}
+
+var (
+	sessionsCache   = make(map[string]SessionsPerGroup)
+	sessionsCacheMu sync.Mutex
+)
+
+// cacheSessions records the sessions last seen on host
+func cacheSessions(host string, sessionsPerGroup SessionsPerGroup) {
+	sessionsCacheMu.Lock()
+	defer sessionsCacheMu.Unlock()
+	sessionsCache[host] = sessionsPerGroup
+}
+
+// cachedSessions returns the sessions last seen on host, without reaching it
+func cachedSessions(host string) SessionsPerGroup {
+	sessionsCacheMu.Lock()
+	defer sessionsCacheMu.Unlock()
+	return sessionsCache[host]
+}
+
+var (
+	localClients   = make(map[string]int)
+	localClientsMu sync.Mutex
+)
+
+// addLocalClient counts the shells of this server attached to
+// the session serialized as hostGroupSess
+func addLocalClient(hostGroupSess string, delta int) {
+	localClientsMu.Lock()
+	defer localClientsMu.Unlock()
+	localClients[hostGroupSess] += delta
+	if localClients[hostGroupSess] <= 0 {
+		delete(localClients, hostGroupSess)
+	}
+}
+
+func localClientsOf(hostGroupSess string) int {
+	localClientsMu.Lock()
+	defer localClientsMu.Unlock()
+	return localClients[hostGroupSess]
+}
+
+// ShellEnd tells how a shell of this server attached to a session ended
+type ShellEnd struct {
+	// ClientGone is set if the client went away, e.g. as its window was
+	// closed, rather than the shell returning on its own, e.g. on detach
+	ClientGone bool
+	At         time.Time
+}
+
+var (
+	shellEnds     = make(map[string][]ShellEnd)
+	shellEndsCond = sync.NewCond(&localClientsMu)
 )
 
+// endLocalClient uncounts a shell attached to hostGroupSess,
+// recording how it ended
+func endLocalClient(hostGroupSess string, clientGone bool) {
+	addLocalClient(hostGroupSess, -1)
+	localClientsMu.Lock()
+	defer localClientsMu.Unlock()
+	shellEnds[hostGroupSess] = append(recentShellEnds(hostGroupSess),
+		ShellEnd{ClientGone: clientGone, At: time.Now()})
+	shellEndsCond.Broadcast()
+}
+
+// recentShellEnds returns the ends of shells attached to hostGroupSess
+// not older than SHELL_END_TTL, oldest first. localClientsMu must be held.
+func recentShellEnds(hostGroupSess string) []ShellEnd {
+	ends := shellEnds[hostGroupSess]
+	for len(ends) > 0 && time.Since(ends[0].At) > SHELL_END_TTL {
+		ends = ends[1:]
+	}
+	return ends
+}
+
+// waitShellEnd waits up to timeout for a shell attached to hostGroupSess
+// to end, unless one ended recently, and consumes its end
+func waitShellEnd(hostGroupSess string, timeout time.Duration) (ShellEnd, bool) {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		localClientsMu.Lock()
+		defer localClientsMu.Unlock()
+		shellEndsCond.Broadcast()
+	})
+	defer timer.Stop()
+	localClientsMu.Lock()
+	defer localClientsMu.Unlock()
+	for {
+		ends := recentShellEnds(hostGroupSess)
+		if len(ends) > 0 {
+			if len(ends) == 1 {
+				delete(shellEnds, hostGroupSess)
+			} else {
+				shellEnds[hostGroupSess] = ends[1:]
+			}
+			return ends[0], true
+		}
+		delete(shellEnds, hostGroupSess)
+		if !time.Now().Before(deadline) {
+			return ShellEnd{}, false
+		}
+		shellEndsCond.Wait()
+	}
+}
+
+// LocalRequest is a request the server answers without reaching the host
+type LocalRequest interface {
+	DoLocal(*Client) Response
+}
+
 func (s *Server) handleClient(conn net.Conn) {
 	defer conn.Close()
 	var err error
@@ -78,20 +235,22 @@ func (s *Server) handleClient(conn net.Conn) {
 		if err = dec.Decode(&r); err != nil {
 			return
 		}
+		if lr, ok := r.(LocalRequest); ok {
+			res := lr.DoLocal(&Client{conn: conn, enc: enc, dec: dec})
+			if err = enc.Encode(&res); err != nil {
+				log.Printf("Error encoding response: %+v\n", err)
+			}
+			continue
+		}
 		host := r.GetHost()
-		sshClient, ok := sshClients[host]
-		if !ok {
-			log.Println("Creating client for", host)
-			sshClient, err = newSSHClient(host)
-			if err != nil {
-				log.Println(fmt.Errorf("Error creating client: %w", err))
-				return
+		sshClient, err := getSSHClient(host)
+		if err != nil {
+			log.Println(fmt.Errorf("Error creating client: %w", err))
+			res := (Response)(newErrorResponse(HostUnreachableError, err.Error()))
+			if err = enc.Encode(&res); err != nil {
+				log.Printf("Error encoding response: %+v\n", err)
 			}
-			sshClients[host] = sshClient
-			go func() {
-				sshClient.Wait()
-				delete(sshClients, host) // FIXME: Implement mutex for concurrent modification
-			}()
+			return
 		}
 		// defer sshClient.Close()
 		fmt.Println(sshClient)
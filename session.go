@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.i3wm.org/i3/v4"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OpenGroup is a group with windows open locally
+type OpenGroup struct {
+	Group string `json:"group"`
+	// Host the layout of the group is saved for, empty for groups
+	// spanning multiple hosts
+	Host       string   `json:"host,omitempty"`
+	Workspaces []string `json:"workspaces"`
+}
+
+// openGroupsSeen tells whether some group was open since i3 started.
+// Until then no group being open is not recorded, so that the groups
+// open before a restart or a logout can be restored.
+var openGroupsSeen bool
+
+func openGroupsPath() string {
+	return path.Join(DATA_DIR, "open-groups.json")
+}
+
+func readOpenGroups() ([]OpenGroup, error) {
+	j, err := ioutil.ReadFile(openGroupsPath())
+	if err != nil {
+		return nil, err
+	}
+	var groups []OpenGroup
+	if err := json.Unmarshal(j, &groups); err != nil {
+		return nil, fmt.Errorf("parsing open groups: %w", err)
+	}
+	return groups, nil
+}
+
+// getOpenGroups returns the groups with windows in the workspaces of tree,
+// sorted by group and host
+func getOpenGroups(tree *i3.Tree) []OpenGroup {
+	byKey := make(map[string]*OpenGroup)
+	tree.Root.FindChild(func(ws *i3.Node) bool {
+		if !isOpenWorkspace(ws) {
+			return false
+		}
+		ws.FindChild(func(n *i3.Node) bool {
+			if !nodeIsLeaf(n) {
+				return false
+			}
+			h, g, _, err := deserializeHostGroupSessFromCon(n)
+			if err != nil {
+				return false
+			}
+			host := layoutHostOf(g, h)
+			key := groupKey(g, host)
+			if _, ok := byKey[key]; !ok {
+				byKey[key] = &OpenGroup{Group: g, Host: host}
+			}
+			wss := byKey[key].Workspaces
+			if len(wss) == 0 || wss[len(wss)-1] != ws.Name {
+				byKey[key].Workspaces = append(wss, ws.Name)
+			}
+			return false
+		})
+		return false
+	})
+	groups := make([]OpenGroup, 0, len(byKey))
+	for _, g := range byKey {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groupKey(groups[i].Group, groups[i].Host) < groupKey(groups[j].Group, groups[j].Host)
+	})
+	return groups
+}
+
+// recordOpenGroups saves groups as the groups open, if they changed
+func recordOpenGroups(groups []OpenGroup) {
+	if len(groups) > 0 {
+		openGroupsSeen = true
+	} else if !openGroupsSeen {
+		return
+	}
+	if saved, err := readOpenGroups(); err == nil && reflect.DeepEqual(saved, groups) {
+		return
+	}
+	j, err := json.Marshal(groups)
+	if err != nil {
+		log.Println("Error serializing open groups", err)
+		return
+	}
+	if err := ioutil.WriteFile(openGroupsPath(), j, 0644); err != nil {
+		log.Println("Error saving open groups", err)
+	}
+}
+
+// restoreSessionAction resumes the groups open before i3 restarted
+// or the user logged out, unless they are still open
+func restoreSessionAction() error {
+	groups, err := readOpenGroups()
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Println("No open groups to restore")
+			return nil
+		}
+		return err
+	}
+	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	open := make(map[string]bool)
+	for _, g := range getOpenGroups(&tree) {
+		open[groupKey(g.Group, g.Host)] = true
+	}
+	// On i3 restarts windows stay open, and nothing is to be restored
+
+	var failed []string
+	for _, g := range groups {
+		if open[groupKey(g.Group, g.Host)] {
+			log.Println("Skipping", groupKey(g.Group, g.Host), "already open")
+			continue
+		}
+		if len(g.Workspaces) > 0 {
+			// Layouts saved elsewhere move groups to their workspaces anyway
+			err := focusWorkspace(g.Workspaces[len(g.Workspaces)-1], "")
+			if err != nil {
+				return err
+			}
+		}
+		if err := resumeAction(g.Group, g.Host, ResumeOptions{}); err != nil {
+			key := groupKey(g.Group, g.Host)
+			log.Printf("Error restoring %s: %s", key, err)
+			failed = append(failed, fmt.Sprintf("%s (%s)", key, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("restoring %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"go.i3wm.org/i3/v4"
+	"reflect"
+	"testing"
+)
+
+func sessionCon(instance string) *i3.Node {
+	n := &i3.Node{Type: i3.Con, Window: 1}
+	n.WindowProperties.Instance = instance
+	return n
+}
+
+func TestGetOpenGroups(t *testing.T) {
+	defer func(saved Pref) { pref = saved }(pref)
+	pref.HideTo = "10:hidden"
+
+	tree := &i3.Tree{Root: &i3.Node{Nodes: []*i3.Node{
+		{Type: i3.WorkspaceNode, Name: "1", Nodes: []*i3.Node{
+			sessionCon("foo_session0@h"),
+			sessionCon("bar_session0@h"),
+		}},
+		{Type: i3.WorkspaceNode, Name: "2", Nodes: []*i3.Node{
+			sessionCon("foo_session1@h"),
+		}},
+		{Type: i3.WorkspaceNode, Name: "10:hidden", Nodes: []*i3.Node{
+			sessionCon("baz_session0@h"),
+		}},
+		{Type: i3.WorkspaceNode, Name: "__i3_scratch", Nodes: []*i3.Node{
+			sessionCon("qux_session0@h"),
+		}},
+	}}}
+	expected := []OpenGroup{
+		{Group: "bar", Host: "h", Workspaces: []string{"1"}},
+		{Group: "foo", Host: "h", Workspaces: []string{"1", "2"}},
+	}
+	if groups := getOpenGroups(tree); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %+v, received %+v", expected, groups)
+	}
+}
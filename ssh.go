@@ -10,6 +10,7 @@ import (
 
 type SSHClient struct {
 	*ssh.Client
+	host string
 }
 
 func newSSHClient(host string) (*SSHClient, error) {
@@ -32,12 +33,13 @@ func newSSHClient(host string) (*SSHClient, error) {
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		// FIXME: check server's key
+		Timeout: pref.HostTimeout,
 	}
 	conn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", conf.Hostname, conf.PortNo), config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to dial: %w", err)
 	}
-	return &SSHClient{conn}, nil
+	return &SSHClient{conn, host}, nil
 }
 
 func (c *SSHClient) Run(cmd string) (string, string, error) {
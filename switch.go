@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"go.i3wm.org/i3/v4"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	SWITCH_HIDE   = "hide"
+	SWITCH_DETACH = "detach"
+)
+
+func previousGroupPath() string {
+	return path.Join(RUNTIME_DIR, "previous-group")
+}
+
+// readPreviousGroup returns the group switched away from last,
+// along with the host its layout is saved for
+func readPreviousGroup() (string, string, error) {
+	b, err := ioutil.ReadFile(previousGroupPath())
+	if err != nil {
+		return "", "", err
+	}
+	group, host := splitGroupHost(strings.TrimSpace(string(b)))
+	return group, host, nil
+}
+
+func writePreviousGroup(group, host string) error {
+	return ioutil.WriteFile(previousGroupPath(), []byte(groupKey(group, host)+"\n"), 0644)
+}
+
+// getWorkspaceGroup returns the group of the focused window, or of the
+// first session in the focused workspace, along with the host its
+// layout is saved for
+func getWorkspaceGroup(tree *i3.Tree) (string, string, bool) {
+	if host, group, _, err := getFocusedSession(tree); err == nil {
+		return group, layoutHostOf(group, host), true
+	}
+	ws, err := getFocusedWs(tree)
+	if err != nil {
+		return "", "", false
+	}
+	var group, host string
+	found := ws.FindChild(func(n *i3.Node) bool {
+		if !nodeIsLeaf(n) {
+			return false
+		}
+		h, g, _, err := deserializeHostGroupSessFromCon(n)
+		if err != nil {
+			return false
+		}
+		group, host = g, layoutHostOf(g, h)
+		return true
+	})
+	return group, host, found != nil
+}
+
+// moveGroupHere moves the windows of group on host, or on any host if host
+// is empty, open in other workspaces of tree to the focused one, and tells
+// whether there were any
+func moveGroupHere(tree *i3.Tree, group, host string) (bool, error) {
+	focused, err := getFocusedWs(tree)
+	if err != nil {
+		return false, withExitCode(ExitI3, err)
+	}
+	var targets []*i3.Node
+	tree.Root.FindChild(func(ws *i3.Node) bool {
+		if !isOpenWorkspace(ws) || ws.ID == focused.ID {
+			return false
+		}
+		for _, v := range ws.Nodes {
+			vTargets, _ := hideTargets(v, group, host)
+			targets = append(targets, vTargets...)
+		}
+		for _, f := range ws.FloatingNodes {
+			if fTargets, _ := hideTargets(f, group, host); len(fTargets) > 0 {
+				// Floating windows move along with their floating container
+				targets = append(targets, f)
+			}
+		}
+		return false
+	})
+	for _, con := range targets {
+		cmd := fmt.Sprintf("[con_id=%d] move container to workspace %s", con.ID, i3Quote(focused.Name))
+		if _, err := i3.RunCommand(cmd); err != nil {
+			return false, withExitCode(ExitI3, fmt.Errorf("moving %s: %w", groupKey(group, host), err))
+		}
+	}
+	return len(targets) > 0, nil
+}
+
+// switchAction puts away the group of the focused workspace, hiding or
+// detaching it as preferred, and brings group there. Without group, it
+// switches back to the previous one.
+func switchAction(group, host string) error {
+	if group == "" {
+		var err error
+		group, host, err = readPreviousGroup()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return usageErrorf("no previous group to switch to")
+			}
+			return err
+		}
+	}
+	hosts, err := hostsOfGroup(group, host)
+	if err != nil {
+		return err
+	}
+	targetHost := layoutHostOf(group, hosts[0])
+
+	tree, err := i3.GetTree()
+	if err != nil {
+		return withExitCode(ExitI3, err)
+	}
+	if curGroup, curHost, ok := getWorkspaceGroup(&tree); ok {
+		if curGroup == group && curHost == targetHost {
+			return nil
+		}
+		if pref.SwitchMode == SWITCH_DETACH {
+			err = detachGroup(&tree, curGroup, curHost)
+		} else {
+			err = hideGroup(&tree, curGroup, curHost)
+		}
+		if err != nil {
+			return fmt.Errorf("putting away %s: %w", groupKey(curGroup, curHost), err)
+		}
+		if err := writePreviousGroup(curGroup, curHost); err != nil {
+			log.Println("Error saving previous group", err)
+		}
+	}
+	// Put away the current group
+
+	hidden := len(getHiddenCons(&tree, groupKey(group, targetHost))) > 0
+	if hidden {
+		if err := showGroup(&tree, group, targetHost, true); err != nil {
+			return err
+		}
+	}
+	moved, err := moveGroupHere(&tree, group, targetHost)
+	if err != nil {
+		return err
+	}
+	if !hidden && !moved {
+		if err := resumeAction(group, host, ResumeOptions{Here: true}); err != nil {
+			return err
+		}
+	}
+	notifySuccess("Switched to group", groupKey(group, targetHost))
+	return nil
+}
+
+// switchPickAction lets the user pick the group to switch to through the menu
+func switchPickAction() error {
+	group, host, choice, err := pickGroup()
+	if err != nil || choice == "" {
+		return err
+	}
+	return switchAction(group, host)
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.i3wm.org/i3/v4"
 )
@@ -75,15 +76,27 @@ func getNextSessIdx(sessionsPerGroup SessionsPerGroup, group string) (int, error
 	return len(sessions), nil
 }
 
-func launchTermForSession(group, session, host string) error {
+func sortedSessions(sessions Sessions) []string {
+	sorted := make([]string, 0, len(sessions))
+	for s := range sessions {
+		sorted = append(sorted, s)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// launchTermForSession launches a terminal running the shell of session,
+// passing shellArgs to the 'shell' command
+func launchTermForSession(group, session, host string, shellArgs ...string) error {
 	groupSess := serializeGroupSess(group, session)
 	hostGroupSess := serializeHostGroupSess(host, group, session)
-	cmd := exec.Command(pref.Terminal.Bin,
-		pref.Terminal.NameFlag, hostGroupSess,
+	args := []string{pref.Terminal.NameFlag, hostGroupSess,
 		"-e", I3TMUX_BIN,
-		"-host", host,
-		"-shell",
-		"-session", groupSess)
+		"shell",
+		"-host", host}
+	args = append(args, shellArgs...)
+	args = append(args, groupSess)
+	cmd := exec.Command(pref.Terminal.Bin, args...)
 	err := cmd.Start()
 	if err != nil {
 		return fmt.Errorf("launching cmd %s: %w", cmd, err)
@@ -91,38 +104,180 @@ func launchTermForSession(group, session, host string) error {
 	return nil
 }
 
-func parseSessionsPerGroup(lines []string) SessionsPerGroup {
+// sessionsPerGroupOf groups the sessions of infos by their group
+func sessionsPerGroupOf(infos []SessionInfo) SessionsPerGroup {
 	sessions := make(SessionsPerGroup)
+	for _, info := range infos {
+		if _, ok := sessions[info.Group]; !ok {
+			sessions[info.Group] = make(Sessions)
+		}
+		sessions[info.Group][info.Session] = true
+	}
+	return sessions
+}
+
+func fetchSessionsPerGroup(sshClient *SSHClient) (SessionsPerGroup, int, string) {
+	infos, errCode, errMsg := fetchSessionInfos(sshClient)
+	if errCode != ErrOk {
+		return nil, errCode, errMsg
+	}
+	return sessionsPerGroupOf(infos), ErrOk, ""
+}
+
+// SessionInfo holds the details of a session shown by 'list'
+type SessionInfo struct {
+	Host     string    `json:"host"`
+	Group    string    `json:"group"`
+	Session  string    `json:"session"`
+	Open     bool      `json:"open"` // has a window in the local i3 tree
+	Attached int       `json:"attached"`
+	Windows  int       `json:"windows"`
+	Command  string    `json:"command"`
+	Activity time.Time `json:"activity"`
+	Created  time.Time `json:"created"`
+}
+
+const sessionInfoFormat = "#{session_name}\t#{session_attached}\t#{session_activity}\t" +
+	"#{session_created}\t#{session_windows}\t#{pane_current_command}"
+
+func parseSessionInfos(lines []string) []SessionInfo {
+	var infos []SessionInfo
 	for _, l := range lines {
-		group, session, err := deserializeGroupSessFromString(l)
-		if err != nil {
+		fields := strings.Split(l, "\t")
+		if len(fields) != 6 {
 			// Skip unrecognized format
 			continue
 		}
-		if _, ok := sessions[group]; !ok {
-			sessions[group] = make(map[string]bool)
+		group, session, err := deserializeGroupSessFromString(fields[0])
+		if err != nil {
+			// Skip sessions not managed by i3tmux
+			continue
+		}
+		info := SessionInfo{Group: group, Session: session, Command: fields[5]}
+		info.Attached, _ = strconv.Atoi(fields[1])
+		info.Windows, _ = strconv.Atoi(fields[4])
+		if activity, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			info.Activity = time.Unix(activity, 0)
+		}
+		if created, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			info.Created = time.Unix(created, 0)
 		}
-		sessions[group][session] = true
+		infos = append(infos, info)
 	}
-	return sessions
+	return infos
 }
 
-func fetchSessionsPerGroup(sshClient *SSHClient) (SessionsPerGroup, int, string) {
-	stdout, stderr, err := sshClient.Run(`tmux ls -F "#{session_name}"`)
+func fetchSessionInfos(sshClient *SSHClient) ([]SessionInfo, int, string) {
+	stdout, stderr, err := sshClient.Run("tmux ls -F " + shellQuote(sessionInfoFormat))
 	if err != nil {
 		if strings.Contains(stderr, "no server running on ") ||
 			strings.Contains(stderr, "No such file or directory") {
-			// return nil, TmuxNoSessionsError
+			cacheSessions(sshClient.host, nil)
 			return nil, TmuxNoSessionsError, stderr
 		}
 		return nil, UnknownError, fmt.Sprintf("%s: %s", stderr, err)
 	}
 	lines := strings.Split(stdout, "\n")
-	return parseSessionsPerGroup(lines), ErrOk, ""
+	infos := parseSessionInfos(lines)
+	cacheSessions(sshClient.host, sessionsPerGroupOf(infos))
+	return infos, ErrOk, ""
 }
 
-func createSession(group, session string, sshClient *SSHClient) (string, string, error) {
+// shellQuote quotes s so that the remote shell passes it verbatim
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// withStart appends the start directory and the initial command
+// to the tmux command creating a session or a window
+func withStart(cmd, cwd, initCmd string) string {
+	if cwd != "" {
+		cmd += " -c " + shellQuote(cwd)
+	}
+	if initCmd != "" {
+		cmd += " " + shellQuote(initCmd)
+	}
+	return cmd
+}
+
+func createSession(group, session, cwd, initCmd string, sshClient *SSHClient) (string, string, error) {
 	sessionGroup := serializeGroupSess(group, session)
 	cmd := fmt.Sprintf("tmux new -d -s %s", sessionGroup)
-	return sshClient.Run(cmd)
+	return sshClient.Run(withStart(cmd, cwd, initCmd))
+}
+
+// WindowSpec describes a tmux window to be recreated
+type WindowSpec struct {
+	Name string
+	Cwd  string
+	Cmd  string // empty if the window runs just a shell
+}
+
+var shells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "fish": true,
+	"dash": true, "ksh": true, "tcsh": true, "csh": true,
+}
+
+func fetchWindowSpecs(group, session string, sshClient *SSHClient) ([]WindowSpec, error) {
+	sessionGroup := serializeGroupSess(group, session)
+	format := "#{window_name}\t#{pane_current_path}\t#{pane_current_command}"
+	cmd := fmt.Sprintf("tmux list-windows -t %s -F %s", sessionGroup, shellQuote(format))
+	stdout, stderr, err := sshClient.Run(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", stderr, err)
+	}
+	var windows []WindowSpec
+	for _, l := range strings.Split(stdout, "\n") {
+		fields := strings.Split(l, "\t")
+		if len(fields) != 3 {
+			// Skip unrecognized format
+			continue
+		}
+		w := WindowSpec{Name: fields[0], Cwd: fields[1], Cmd: fields[2]}
+		if shells[w.Cmd] {
+			w.Cmd = ""
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func recreateSession(group, session string, windows []WindowSpec, sshClient *SSHClient) (string, string, error) {
+	if len(windows) == 0 {
+		return createSession(group, session, "", "", sshClient)
+	}
+	sessionGroup := serializeGroupSess(group, session)
+	for i, w := range windows {
+		var cmd string
+		if i == 0 {
+			cmd = fmt.Sprintf("tmux new -d -s %s -n %s", sessionGroup, shellQuote(w.Name))
+		} else {
+			cmd = fmt.Sprintf("tmux new-window -d -t %s: -n %s", sessionGroup, shellQuote(w.Name))
+		}
+		stdout, stderr, err := sshClient.Run(withStart(cmd, w.Cwd, w.Cmd))
+		if err != nil {
+			return stdout, stderr, err
+		}
+	}
+	return "", "", nil
+}
+
+// killSession kills session of group, returning the stderr of tmux on error
+func killSession(group, session string, sshClient *SSHClient) (string, error) {
+	cmd := fmt.Sprintf("tmux kill-session -t %s", serializeGroupSess(group, session))
+	_, stderr, err := sshClient.Run(cmd)
+	if err != nil {
+		return stderr, fmt.Errorf("%s: %w", cmd, err)
+	}
+	return "", nil
+}
+
+func fetchPaneCurrentPath(group, session string, sshClient *SSHClient) (string, error) {
+	sessionGroup := serializeGroupSess(group, session)
+	cmd := fmt.Sprintf(`tmux display-message -p -t %s "#{pane_current_path}"`, sessionGroup)
+	stdout, stderr, err := sshClient.Run(cmd)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", stderr, err)
+	}
+	return strings.TrimSpace(stdout), nil
 }